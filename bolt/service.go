@@ -3,11 +3,9 @@
 package bolt
 
 import (
-	"flag"
 	"fmt"
 	"github.com/peter-mount/go-kernel/v2"
 	"go.etcd.io/bbolt"
-	"os"
 	"time"
 )
 
@@ -21,9 +19,10 @@ func (s *BoltService) Name() string {
 	return "bolt:" + s.FileName
 }
 
-func (s *BoltService) Init(_ *kernel.Kernel) error {
+func (s *BoltService) Init(k *kernel.Kernel) error {
 	if s.FileName == "" {
-		s.dbFile = flag.String("bucket-store", "", "The file to store all buckets")
+		s.dbFile = k.FlagSet().String("bucket-store", "", "The file to store all buckets")
+		k.SetFlagEnv("bucket-store", "BUCKETSTORE")
 	}
 	return nil
 }
@@ -33,9 +32,6 @@ func (s *BoltService) PostInit() error {
 		s.FileName = *s.dbFile
 	}
 
-	if s.FileName == "" {
-		s.FileName = os.Getenv("BUCKETSTORE")
-	}
 	if s.FileName == "" {
 		return fmt.Errorf("No store provided by -bucket-store or BUCKETSTORE")
 	}
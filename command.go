@@ -0,0 +1,190 @@
+package kernel
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// command is a subcommand registered with the kernel
+type command struct {
+	name        string    // Name of the command
+	description string    // Description shown in the usage
+	services    []Service // Services deployed when the command is selected
+}
+
+// RegisterCommand registers a subcommand with the global kernel.
+// If the kernel has been started then this will panic.
+//
+// This is normally used within a packages' init() function, e.g.
+//
+//	func init() {
+//		kernel.RegisterCommand("migrate", "Migrate the database", &Migrate{})
+//	}
+func RegisterCommand(name, description string, services ...Service) {
+	if err := instance.AddCommand(name, description, services...); err != nil {
+		panic(err)
+	}
+}
+
+// AddCommand adds a subcommand to the kernel, e.g. the "serve" in "app serve -port 8080".
+//
+// Once any command has been added, the first argument after any global flags must be one of them.
+// Only the services of that command are then deployed, after the services added with AddService or DependsOn,
+// which can be used for anything common to all commands.
+//
+// Each command has its own flag.FlagSet, which is returned by FlagSet() whilst its services are deployed,
+// so any flags they declare are only available after the command name.
+func (k *Kernel) AddCommand(name, description string, services ...Service) error {
+	if err := k.assertAmendable(); err != nil {
+		return err
+	}
+
+	if name == "" || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid command name %q", name)
+	}
+
+	if _, exists := k.commands[name]; exists {
+		return fmt.Errorf("command %q already registered", name)
+	}
+
+	if len(services) == 0 {
+		return fmt.Errorf("command %q has no services", name)
+	}
+
+	k.commands[name] = &command{name: name, description: description, services: services}
+	return nil
+}
+
+// Command returns the name of the selected command, "" if no commands have been added
+// or the kernel has not yet been run.
+func (k *Kernel) Command() string {
+	if k.command == nil {
+		return ""
+	}
+	return k.command.name
+}
+
+// Args returns the arguments remaining after the command line flags have been parsed,
+// excluding the command name if one was selected.
+func (k *Kernel) Args() []string {
+	return k.FlagSet().Args()
+}
+
+// commandNames returns the names of the registered commands in order
+func (k *Kernel) commandNames() []string {
+	var names []string
+	for name := range k.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandConfigSections returns the config sections used by the services of every command, so that a config file
+// shared between commands is valid whichever one is selected.
+//
+// As the services of the other commands are not deployed, these are found from the kernel tags on their fields and
+// those of any services they inject by pointer. Services they add within Init are not included.
+func (k *Kernel) commandConfigSections() map[string]bool {
+	sections := make(map[string]bool)
+	visited := make(map[reflect.Type]bool)
+	for _, c := range k.commands {
+		for _, s := range c.services {
+			addConfigSections(reflect.TypeOf(s), sections, visited)
+		}
+	}
+	return sections
+}
+
+// addConfigSections adds the config sections used by the kernel tags of a service type to sections
+func addConfigSections(t reflect.Type, sections map[string]bool, visited map[reflect.Type]bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || visited[t] {
+		return
+	}
+	visited[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("kernel")
+		if !ok {
+			continue
+		}
+
+		tags := strings.Split(tag, ",")
+		switch tags[0] {
+		case "config":
+			// As injectConfig, the section defaults to the field name
+			if len(tags) > 1 && tags[1] != "" {
+				sections[tags[1]] = true
+			} else {
+				sections[sf.Name] = true
+			}
+
+		case "flag":
+			// Any config=section.key option after the name, usage & default
+			for j := 4; j < len(tags); j++ {
+				if value, found := strings.CutPrefix(tags[j], "config="); found && value != "" {
+					section, _, _ := strings.Cut(value, ".")
+					sections[section] = true
+				}
+			}
+
+		case "inject":
+			if sf.Type.Kind() == reflect.Ptr {
+				addConfigSections(sf.Type, sections, visited)
+			}
+		}
+	}
+}
+
+// flagSets returns the kernel's global FlagSet, followed by that of the selected command if any
+func (k *Kernel) flagSets() []*flag.FlagSet {
+	if k.command != nil {
+		return []*flag.FlagSet{k.flags, k.command.flags}
+	}
+	return []*flag.FlagSet{k.flags}
+}
+
+// selectCommand deploys the services of the command named by the first argument
+// then parses the arguments following it
+func (k *Kernel) selectCommand() error {
+	if len(k.commands) == 0 {
+		return nil
+	}
+
+	name := k.flags.Arg(0)
+	if name == "" {
+		return fmt.Errorf("no command given, expected one of %s", strings.Join(k.commandNames(), ", "))
+	}
+
+	c, exists := k.commands[name]
+	if !exists {
+		return fmt.Errorf("unknown command %q, expected one of %s", name, strings.Join(k.commandNames(), ", "))
+	}
+
+	k.command = &selectedCommand{
+		command: c,
+		flags:   flag.NewFlagSet(name, k.flags.ErrorHandling()),
+	}
+	k.command.flags.SetOutput(k.flags.Output())
+	k.command.flags.Usage = k.usage
+
+	// Deploy the command's services
+	if err := k.DependsOn(c.services...); err != nil {
+		return err
+	}
+
+	return k.command.flags.Parse(k.flags.Args()[1:])
+}
+
+// selectedCommand is the command being run
+type selectedCommand struct {
+	*command
+	flags *flag.FlagSet // The command's flags
+}
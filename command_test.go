@@ -0,0 +1,143 @@
+package kernel
+
+import (
+	"strings"
+	"testing"
+)
+
+type testServeCommand struct {
+	port    *int         `kernel:"flag,port,Port to listen on,80"`
+	verbose *bool        `kernel:"flag,v"`
+	common  *testService `kernel:"inject"`
+	run     bool
+}
+
+func (s *testServeCommand) Run() error {
+	s.run = true
+	return nil
+}
+
+type testMigrateCommand struct {
+	dryRun *bool `kernel:"flag,dry-run"`
+	run    bool
+}
+
+func (s *testMigrateCommand) Run() error {
+	s.run = true
+	return nil
+}
+
+func newTestCommandKernel(t *testing.T, args ...string) (*Kernel, *testServeCommand, *testMigrateCommand) {
+	serve := &testServeCommand{}
+	migrate := &testMigrateCommand{}
+
+	k := NewKernel()
+	k.SetArgs(args...)
+	if err := k.DependsOn(&testService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.AddCommand("serve", "Run the server", serve); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.AddCommand("migrate", "Migrate the database", migrate); err != nil {
+		t.Fatal(err)
+	}
+	return k, serve, migrate
+}
+
+func TestKernel_Command(t *testing.T) {
+	k, serve, migrate := newTestCommandKernel(t, "-shutdown-timeout", "1s", "serve", "-port", "8080", "extra")
+
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if k.Command() != "serve" || !serve.run || migrate.run {
+		t.Errorf("expected only serve to run, got %q %v %v", k.Command(), serve.run, migrate.run)
+	}
+
+	if *serve.port != 8080 || serve.common == nil || !serve.common.run {
+		t.Errorf("serve not deployed correctly")
+	}
+
+	if migrate.dryRun != nil {
+		t.Error("migrate was deployed")
+	}
+
+	if args := k.Args(); len(args) != 1 || args[0] != "extra" {
+		t.Errorf("expected args [extra], got %v", args)
+	}
+}
+
+func TestKernel_CommandFlags(t *testing.T) {
+	// -port belongs to serve so cannot be used with migrate
+	k, _, _ := newTestCommandKernel(t, "migrate", "-port", "8080")
+	k.flags.SetOutput(&strings.Builder{})
+
+	if err := k.Run(); err == nil {
+		t.Error("expected -port to be undefined for migrate")
+	}
+}
+
+func TestKernel_CommandMissing(t *testing.T) {
+	for _, args := range [][]string{nil, {"export"}} {
+		k, _, _ := newTestCommandKernel(t, args...)
+
+		err := k.Run()
+		if err == nil || !strings.Contains(err.Error(), "expected one of migrate, serve") {
+			t.Errorf("%v: expected the commands to be listed, got %v", args, err)
+		}
+	}
+}
+
+type testCommandConfig struct {
+	Value string `yaml:"value"`
+}
+
+// testServeConfigService is injected by testServeConfigCommand so its config is only found through it
+type testServeConfigService struct {
+	config *testCommandConfig `kernel:"config,http"`
+}
+
+type testServeConfigCommand struct {
+	service *testServeConfigService `kernel:"inject"`
+}
+
+type testMigrateConfigCommand struct {
+	config *testCommandConfig `kernel:"config,db"`
+}
+
+// TestKernel_CommandConfig ensures a config file shared between commands is valid in strict mode
+// whichever command is selected, whilst a section used by none of them is not
+func TestKernel_CommandConfig(t *testing.T) {
+	for _, test := range []struct {
+		content string
+		valid   bool
+	}{
+		{content: "http:\n  value: a\ndb:\n  value: b\n", valid: true},
+		{content: "http:\n  value: a\nunknown:\n  value: b\n"},
+	} {
+		filename := writeTestConfig(t, test.content)
+
+		migrate := &testMigrateConfigCommand{}
+		k := NewKernel()
+		k.SetArgs("migrate", "-config", filename)
+		k.SetStrictConfig(true)
+		if err := k.AddCommand("serve", "Run the server", &testServeConfigCommand{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := k.AddCommand("migrate", "Migrate the database", migrate); err != nil {
+			t.Fatal(err)
+		}
+
+		err := k.Run()
+		switch {
+		case test.valid && err != nil:
+			t.Errorf("expected config to be valid, got %v", err)
+		case test.valid && migrate.config.Value != "b":
+			t.Errorf("expected db config to be loaded, got %q", migrate.config.Value)
+		case !test.valid && (err == nil || !strings.Contains(err.Error(), "unknown config section \"unknown\"")):
+			t.Errorf("expected unknown section, got %v", err)
+		}
+	}
+}
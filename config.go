@@ -2,12 +2,19 @@ package kernel
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/peter-mount/go-kernel/v2/util/injection"
 	"gopkg.in/yaml.v2"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
+	"time"
 )
 
 // dynamicConfig is an extensible yaml based config file format.
@@ -18,17 +25,45 @@ import (
 //
 // In the config file, the yaml consists of objects, one per service.
 type dynamicConfig struct {
-	filename *string                 `kernel:"flag,config,Configuration file,config.yaml"`
-	entries  map[string]*configEntry // Map of entries
-	files    map[string]interface{}  // Map used to prevent infinite loop loading files
+	filename     *string                 `kernel:"flag,config,Configuration file,config.yaml"`
+	kernel       *Kernel                 // The kernel we are deployed in
+	entries      map[string]*configEntry // Map of entries
+	files        map[string]time.Time    // Files last read and their modification time
+	reloadMutex  sync.Mutex              // Prevents concurrent reloads
+	flagSections map[string]bool         // Sections used by flags
+	initial      *configLoader           // Config loaded before the Start phase, applied by StartContext
 }
 
 type configEntry struct {
 	name            string             // Name of entry in yaml file
 	config          interface{}        // Config to inject into
+	baseline        interface{}        // Copy of config before it was first loaded
 	injectionPoints []*injection.Point // Injection points to receive this config
 }
 
+// configLoader loads the config files into new instances of each entry,
+// so the current config is untouched until the load has completed.
+type configLoader struct {
+	dc       *dynamicConfig
+	files    map[string]time.Time       // Files read, also used to prevent infinite loops
+	configs  map[string]interface{}     // New config by entry name
+	sections map[string]*configLocation // Where each section was defined
+	values   map[string]interface{}     // If not nil, the raw value of each section
+	commands map[string]bool            // Sections used by the services of every command
+	errs     []error                    // Problems found whilst loading
+}
+
+func (dc *dynamicConfig) Init(k *Kernel) error {
+	dc.kernel = k
+	declareFlag(k.FlagSet(), configWatchFlag, time.Duration(0), "Interval to check config files for changes, 0 to disable")
+	declareFlag(k.FlagSet(), configDumpFlag, false, "Print the effective configuration then exit")
+	return nil
+}
+
+func (dc *dynamicConfig) Describe() string {
+	return "Configuration files"
+}
+
 // Add a named config entry. Returns an Error if the name is already in use
 func (dc *dynamicConfig) add(name string, ip *injection.Point) error {
 	if dc.entries == nil {
@@ -40,38 +75,250 @@ func (dc *dynamicConfig) add(name string, ip *injection.Point) error {
 	// Create the entry on first use
 	if !exists {
 		e = &configEntry{name: name}
-		dc.entries[name] = e
 
-		// The shared instance
+		// The shared instance, with any default values
 		e.config = ip.New()
+		if err := applyDefaults(reflect.ValueOf(e.config).Elem()); err != nil {
+			return ip.Errorf("config %s: %v", name, err)
+		}
+
+		dc.entries[name] = e
 	}
 
-	// Inject the shared instance
+	// Inject the shared instance. A value gets a copy which is updated when the config is loaded
 	ip.Set(e.config)
+	e.injectionPoints = append(e.injectionPoints, ip)
 
 	return nil
 }
 
-func (dc *dynamicConfig) Start() error {
-	dc.files = make(map[string]interface{})
-	return dc.processFile(*dc.filename)
+// newInstance returns a copy of the entry as it was before config was loaded
+func (e *configEntry) newInstance() interface{} {
+	if e.baseline == nil {
+		e.baseline = copyConfig(e.config)
+	}
+	return copyConfig(e.baseline)
+}
+
+// copyConfig returns a deep copy of a config struct, so that loading into the copy
+// cannot modify any maps or slices shared with the original.
+func copyConfig(c interface{}) interface{} {
+	v := reflect.ValueOf(c).Elem()
+	n := reflect.New(v.Type())
+	n.Elem().Set(deepCopy(v))
+	return n.Interface()
+}
+
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.New(v.Type().Elem())
+		n.Elem().Set(deepCopy(v.Elem()))
+		return n
+
+	case reflect.Struct:
+		// Shallow copy first so unexported fields are kept, then copy what we can
+		n := reflect.New(v.Type()).Elem()
+		n.Set(v)
+		for i := 0; i < n.NumField(); i++ {
+			if f := n.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i)))
+			}
+		}
+		return n
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			n.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return n
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		n := reflect.MakeMapWithSize(v.Type(), v.Len())
+		it := v.MapRange()
+		for it.Next() {
+			n.SetMapIndex(it.Key(), deepCopy(it.Value()))
+		}
+		return n
+
+	default:
+		return v
+	}
+}
+
+// applyDefaults sets any zero fields in a struct which have a default tag, e.g. `default:"30s"`
+func applyDefaults(v reflect.Value) error {
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		f := v.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+
+		if value, exists := sf.Tag.Lookup("default"); exists && f.IsZero() {
+			if err := setStringValue(f, value); err != nil {
+				return fmt.Errorf("invalid default %q for %s: %w", value, sf.Name, err)
+			}
+			continue
+		}
+
+		// Nested structs use their own defaults
+		if err := applyDefaults(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadInitial loads and validates the config before the Start phase,
+// so that invalid config prevents any service from starting
+func (dc *dynamicConfig) loadInitial() error {
+	l, err := dc.load()
+	if err != nil {
+		return err
+	}
+	dc.initial = l
+	return nil
+}
+
+// StartContext applies the config loaded by loadInitial then watches for changes
+func (dc *dynamicConfig) StartContext(ctx context.Context) error {
+	if dc.initial == nil {
+		if err := dc.loadInitial(); err != nil {
+			return err
+		}
+	}
+	dc.apply(dc.initial)
+	dc.initial = nil
+
+	go dc.watch(ctx)
+	return nil
+}
+
+// load reads the config files into a configLoader
+func (dc *dynamicConfig) load() (*configLoader, error) {
+	l := &configLoader{
+		dc:       dc,
+		files:    make(map[string]time.Time),
+		configs:  make(map[string]interface{}),
+		sections: make(map[string]*configLocation),
+		commands: dc.kernel.commandConfigSections(),
+	}
+
+	for name, e := range dc.entries {
+		l.configs[name] = e.newInstance()
+	}
+
+	if err := l.processFile(*dc.filename); err != nil {
+		return nil, err
+	}
+
+	if err := l.applyEnv(); err != nil {
+		l.errs = append(l.errs, err)
+	}
+
+	l.validate()
+
+	if err := errors.Join(l.errs...); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// loadValues reads the config files returning the raw value of every section
+func (dc *dynamicConfig) loadValues() (map[string]interface{}, error) {
+	l := &configLoader{
+		dc:       dc,
+		files:    make(map[string]time.Time),
+		sections: make(map[string]*configLocation),
+		values:   make(map[string]interface{}),
+	}
+
+	if err := l.processFile(*dc.filename); err != nil {
+		return nil, err
+	}
+
+	if err := errors.Join(l.errs...); err != nil {
+		return nil, err
+	}
+	return l.values, nil
+}
+
+// apply replaces the current config with that from a configLoader,
+// returning the names of the sections that have changed.
+func (dc *dynamicConfig) apply(l *configLoader) []string {
+	dc.kernel.configMutex.Lock()
+	defer dc.kernel.configMutex.Unlock()
+
+	var changed []string
+	for name, e := range dc.entries {
+		c := l.configs[name]
+		if !reflect.DeepEqual(e.config, c) {
+			reflect.ValueOf(e.config).Elem().Set(reflect.ValueOf(c).Elem())
+			changed = append(changed, name)
+		}
+
+		for _, ip := range e.injectionPoints {
+			if ip.IsValue() {
+				ip.Set(e.config)
+			}
+		}
+	}
+
+	dc.files = l.files
+	return changed
 }
 
 const (
-	includePrefix = "#include "
+	includePrefix    = "#include "
+	includeDirPrefix = "#include-dir "
 )
 
-func (dc *dynamicConfig) processFile(filename string) error {
+// configBlock is a section read from a config file
+type configBlock struct {
+	file    string   // File containing the block
+	lines   []string // The lines in the block
+	lineNos []int    // Line number in the file of each line
+}
+
+func (b *configBlock) add(line string, lineNo int) {
+	b.lines = append(b.lines, line)
+	b.lineNos = append(b.lineNos, lineNo)
+}
+
+// line returns the line number in the file of a line in the block, starting from 1
+func (b *configBlock) line(n int) int {
+	if n < 1 || n > len(b.lineNos) {
+		return b.lineNos[0]
+	}
+	return b.lineNos[n-1]
+}
+
+func (l *configLoader) processFile(filename string) error {
 	absFileName, err := filepath.Abs(filename)
 	if err != nil {
 		return err
 	}
 
 	// Prevent loading the same file twice
-	if _, exists := dc.files[absFileName]; exists {
+	if _, exists := l.files[absFileName]; exists {
 		return fmt.Errorf("already read %q, possible infinite loop", absFileName)
 	}
-	dc.files[absFileName] = true
 
 	f, err := os.Open(filename)
 	if err != nil {
@@ -79,85 +326,151 @@ func (dc *dynamicConfig) processFile(filename string) error {
 	}
 	defer f.Close()
 
-	var lines []string
-	scanner := bufio.NewScanner(f)
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	l.files[absFileName] = info.ModTime()
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return l.processJSON(filename, f)
+	case ".toml":
+		return l.processTOML(filename, f)
+	default:
+		return l.processYAML(filename, f)
+	}
+}
+
+// processYAML reads a yaml file, handling any #include or #include-dir directives
+func (l *configLoader) processYAML(filename string, r io.Reader) error {
+	block := &configBlock{file: filename}
+	lineNo := 0
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := scanner.Text()
+		lineNo++
 
 		if len(line) > 0 {
 			c := line[0]
 			switch {
 
+			case strings.HasPrefix(line, includeDirPrefix):
+				// As with #include but loads every config file in a directory
+				l.processBlock(block)
+				block = &configBlock{file: filename}
+
+				if dir, ok := includeName(line[len(includeDirPrefix):]); ok {
+					if err := l.processDir(dir); err != nil {
+						l.errorf(filename, lineNo, "%v", err)
+					}
+				} else {
+					l.errorf(filename, lineNo, "invalid #include-dir %q", line)
+				}
+
 			case strings.HasPrefix(line, includePrefix):
 				// Process any existing block
-				if err := dc.processBlock(lines); err != nil {
-					return err
-				}
+				l.processBlock(block)
 
 				// Clear the current block, so we start a fresh once the included file has been read
-				lines = nil
-
-				// Everything after includePrefix is the filename, trim excess white space
-				nextFilename := strings.TrimSpace(line[len(includePrefix):])
-				l := len(nextFilename)
+				block = &configBlock{file: filename}
 
-				// If filename is not empty and is wrapped with " then load it
-				if l > 2 && nextFilename[0] == '"' && nextFilename[l-1] == '"' {
-					err = dc.processFile(nextFilename[1 : l-1])
-					if err != nil {
-						return err
+				// Everything after includePrefix is the filename
+				if nextFilename, ok := includeName(line[len(includePrefix):]); ok {
+					if err := l.processFile(nextFilename); err != nil {
+						l.errorf(filename, lineNo, "%v", err)
 					}
 				} else {
-					return fmt.Errorf("invalid #include %q in %q", line, filename)
+					l.errorf(filename, lineNo, "invalid #include %q", line)
 				}
 
 			case c == '#':
 				// Strip comments
 
-			case (c >= 'A' && c < 'Z') || (c >= 'a' && c < 'z'):
+			case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z'):
 				// Line starts with a character then it's the start of a block
 
 				// Process any existing block
-				if err := dc.processBlock(lines); err != nil {
-					return err
-				}
+				l.processBlock(block)
 
 				// Start the block with this line
-				lines = []string{line}
+				block = &configBlock{file: filename}
+				block.add(line, lineNo)
 
 			default:
 				// Append to the line list
-				lines = append(lines, line)
+				block.add(line, lineNo)
 			}
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
 	// Handle last config block
-	return dc.processBlock(lines)
+	l.processBlock(block)
+	return nil
 }
 
-func (dc *dynamicConfig) processBlock(lines []string) error {
-	if len(lines) > 0 {
-		i := strings.Index(lines[0], ":")
-		if i < 0 {
-			return fmt.Errorf("invalid config parameter %s", strings.Join(lines, "\\n"))
-		}
+func (l *configLoader) processBlock(block *configBlock) {
+	if len(block.lines) == 0 {
+		return
+	}
 
-		// Name of section, keep everything after : but trimmed incase it's a simple config entry
-		n := lines[0][:i]
-		lines[0] = strings.TrimSpace(lines[0][i+1:])
+	i := strings.Index(block.lines[0], ":")
+	if i < 0 {
+		l.errorf(block.file, block.line(1), "invalid config parameter %q", block.lines[0])
+		return
+	}
 
-		if e, exists := dc.entries[n]; exists {
-			b := []byte(strings.Join(lines, "\n"))
+	// Name of section, keep everything after : but trimmed incase it's a simple config entry
+	n := block.lines[0][:i]
+	block.lines[0] = strings.TrimSpace(block.lines[0][i+1:])
 
-			if err := yaml.Unmarshal(b, e.config); err != nil {
-				return err
-			}
+	l.processSection(n, block)
+}
+
+// processSection loads a section into its config. The first line in the block is anything
+// following the section name, the rest the body of the section.
+func (l *configLoader) processSection(n string, block *configBlock) {
+	// When reading values for flags, every section is read without a config
+	if l.values != nil {
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(interpolate(strings.Join(block.lines, "\n"))), &v); err != nil {
+			l.yamlError(block, err)
 		} else {
-			// TODO display warning here of an unused section in the read yaml? It isn't an error however
+			l.values[n] = v
 		}
+		return
+	}
+
+	c, exists := l.configs[n]
+	if !exists {
+		if l.dc.flagSections[n] || l.commands[n] {
+			// Used by a flag, or by a command which has not been selected
+			return
+		}
+
+		if l.dc.kernel.strictConfig {
+			l.errorf(block.file, block.line(1), "unknown config section %q", n)
+		} else {
+			log.Printf("%s:%d: config section %q is not used", block.file, block.line(1), n)
+		}
+		return
+	}
+
+	l.recordLocation(n, block)
+
+	b := []byte(interpolate(strings.Join(block.lines, "\n")))
+
+	unmarshal := yaml.Unmarshal
+	if l.dc.kernel.strictConfig {
+		unmarshal = yaml.UnmarshalStrict
+	}
+	if err := unmarshal(b, c); err != nil {
+		l.yamlError(block, err)
 	}
-	return nil
 }
 
 func (k *Kernel) injectConfig(tags []string, ip *injection.Point) error {
@@ -174,7 +487,7 @@ func (k *Kernel) injectConfig(tags []string, ip *injection.Point) error {
 	}
 
 	// lazy init service
-	sv, err := k.AddService(&dynamicConfig{})
+	sv, err := k.deploy(&dynamicConfig{})
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,185 @@
+package kernel
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// configDumpFlag is the flag used to print the config then exit
+	configDumpFlag = "config-dump"
+	// secretMask replaces the value of any config field tagged `secret:"true"`
+	secretMask = "********"
+)
+
+func (k *Kernel) configDump() bool {
+	dump, _ := k.flagValue(configDumpFlag).(bool)
+	return dump
+}
+
+// DumpConfig writes the effective configuration as yaml, with a comment showing where each value was set.
+// Fields with a secret tag, e.g. `secret:"true"`, are masked.
+//
+// This loads the config files, so it shows what would be used if the kernel was started now.
+func (k *Kernel) DumpConfig(w io.Writer) error {
+	dc := k.dynamicConfig()
+	if dc == nil {
+		return nil
+	}
+
+	l, err := dc.load()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range l.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := l.dumpSection(w, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpSection writes a single section
+func (l *configLoader) dumpSection(w io.Writer, name string) error {
+	c := reflect.ValueOf(l.configs[name]).Elem()
+
+	loc := l.sections[name]
+
+	// Not a struct, so a simple value defined by the section itself
+	if c.Kind() != reflect.Struct {
+		src := "default"
+		if loc != nil && loc.file != "" {
+			src = fmt.Sprintf("%s:%d", loc.file, loc.line)
+		}
+		_, err := fmt.Fprintf(w, "# %s\n%s", src, yamlEntry(yaml.MapItem{Key: name, Value: c.Interface()}))
+		return err
+	}
+
+	// Marshal then unmarshal into a MapSlice so we have each key in order
+	b, err := yaml.Marshal(c.Interface())
+	if err != nil {
+		return err
+	}
+
+	var keys yaml.MapSlice
+	if err := yaml.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	maskSecrets(c.Type(), keys)
+
+	if _, err := fmt.Fprintf(w, "%s:\n", name); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		src := "default"
+		if loc != nil {
+			if s, exists := loc.keys[fmt.Sprint(key.Key)]; exists {
+				src = s.String()
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, "  # %s\n%s", src, indent(yamlEntry(key))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// yamlEntry returns a single map entry as yaml
+func yamlEntry(item yaml.MapItem) string {
+	b, err := yaml.Marshal(yaml.MapSlice{item})
+	if err != nil {
+		return fmt.Sprintf("# %v: %v\n", item.Key, err)
+	}
+	return string(b)
+}
+
+// indent indents each line by two spaces
+func indent(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "  " + line
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// maskSecrets replaces the value of any field tagged `secret:"true"` with secretMask,
+// where v is a value of type t after it has been marshalled to yaml
+func maskSecrets(t reflect.Type, v interface{}) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, _ := v.(yaml.MapSlice)
+		for i := range m {
+			sf, exists := yamlField(t, fmt.Sprint(m[i].Key))
+			switch {
+			case !exists:
+			case sf.Tag.Get("secret") == "true":
+				m[i].Value = secretMask
+			default:
+				maskSecrets(sf.Type, m[i].Value)
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		s, _ := v.([]interface{})
+		for _, e := range s {
+			maskSecrets(t.Elem(), e)
+		}
+
+	case reflect.Map:
+		m, _ := v.(yaml.MapSlice)
+		for _, e := range m {
+			maskSecrets(t.Elem(), e.Value)
+		}
+	}
+}
+
+// yamlField returns the field in a struct which is marshalled with the given key
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		tags := strings.Split(sf.Tag.Get("yaml"), ",")
+		name := tags[0]
+		if name == "-" {
+			continue
+		}
+
+		for _, opt := range tags[1:] {
+			if opt == "inline" {
+				if f, exists := yamlField(sf.Type, key); exists {
+					return f, true
+				}
+			}
+		}
+
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		if name == key {
+			return sf, true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -0,0 +1,126 @@
+package kernel
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const (
+	// defaultEnvPrefix is the prefix of environment variables which override config
+	defaultEnvPrefix = "APP"
+)
+
+// interpolatePattern matches ${VAR} and ${VAR:-default}
+var interpolatePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?}`)
+
+// SetEnvPrefix sets the prefix of the environment variables which override config values.
+// The default is "APP" so the Rate field in section limits is overridden by APP_LIMITS_RATE.
+func (k *Kernel) SetEnvPrefix(prefix string) {
+	k.envPrefix = prefix
+}
+
+// interpolate replaces ${VAR} with the value of the environment variable VAR.
+// ${VAR:-default} uses default if VAR is not set or is empty.
+func interpolate(s string) string {
+	return interpolatePattern.ReplaceAllStringFunc(s, func(m string) string {
+		g := interpolatePattern.FindStringSubmatch(m)
+		if v := os.Getenv(g[1]); v != "" || g[2] == "" {
+			return v
+		}
+		return g[3]
+	})
+}
+
+// envName converts a section or field name into the form used in an environment variable
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// applyEnv overrides the fields of each config section with any matching environment variables
+func (l *configLoader) applyEnv() error {
+	prefix := l.dc.kernel.envPrefix
+	for name, c := range l.configs {
+		if err := l.applyEnvStruct(name, "", envName(prefix+"_"+name), reflect.ValueOf(c).Elem()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyEnvStruct overrides the fields of a struct in a section. key is the top level key in the
+// section containing the struct, "" for the section itself.
+func (l *configLoader) applyEnvStruct(section, key, prefix string, v reflect.Value) error {
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		f := v.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+
+		name, ok := yamlFieldName(sf)
+		if !ok {
+			continue
+		}
+		envVar := prefix + "_" + envName(name)
+
+		fieldKey := key
+		if fieldKey == "" {
+			fieldKey = name
+		}
+
+		if value, exists := os.LookupEnv(envVar); exists {
+			if err := setStringValue(f, value); err != nil {
+				return fmt.Errorf("%s: %w", envVar, err)
+			}
+			l.location(section).keys[fieldKey] = configSource{env: envVar}
+			continue
+		}
+
+		// Nested structs use their own fields
+		switch {
+		case f.Kind() == reflect.Struct:
+			if err := l.applyEnvStruct(section, fieldKey, envVar, f); err != nil {
+				return err
+			}
+		case f.Kind() == reflect.Ptr && f.Type().Elem().Kind() == reflect.Struct && !f.IsNil():
+			if err := l.applyEnvStruct(section, fieldKey, envVar, f.Elem()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setStringValue sets a field from an environment variable or default tag. Strings are used as-is,
+// anything else is parsed as yaml so numbers, booleans and lists like [a, b] are supported.
+func setStringValue(f reflect.Value, value string) error {
+	if f.Kind() == reflect.String {
+		f.SetString(value)
+		return nil
+	}
+
+	n := reflect.New(f.Type())
+	if err := yaml.Unmarshal([]byte(value), n.Interface()); err != nil {
+		return err
+	}
+	f.Set(n.Elem())
+	return nil
+}
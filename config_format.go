@@ -0,0 +1,233 @@
+package kernel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// configExtensions are the file extensions loaded by #include-dir
+var configExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+	".toml": true,
+}
+
+// includeName returns the name in an #include or #include-dir directive which must be wrapped with "
+func includeName(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	n := len(s)
+	if n > 2 && s[0] == '"' && s[n-1] == '"' {
+		return s[1 : n-1], true
+	}
+	return "", false
+}
+
+// processDir loads every config file in a directory in lexical order.
+// Files with an unknown extension are ignored.
+func (l *configLoader) processDir(dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	// Prevent loading the same directory twice
+	if _, exists := l.files[absDir]; exists {
+		return fmt.Errorf("already read %q, possible infinite loop", absDir)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%q is not a directory", dir)
+	}
+
+	// Record the directory so a watch sees files being added or removed
+	l.files[absDir] = info.ModTime()
+
+	// ReadDir returns the entries sorted by name
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !configExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+
+		if err := l.processFile(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configSection is a section read from a json or toml file
+type configSection struct {
+	name  string
+	line  int
+	value interface{}
+}
+
+// processSections converts each section into yaml so that it is loaded the same way as a yaml file
+func (l *configLoader) processSections(filename string, sections []configSection) {
+	for _, section := range sections {
+		b, err := yaml.Marshal(section.value)
+		if err != nil {
+			l.errorf(filename, section.line, "%s: %v", section.name, err)
+			continue
+		}
+
+		// The first line is what follows the section name, which is always empty
+		block := &configBlock{file: filename}
+		block.add("", section.line)
+		for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+			block.add(line, section.line)
+		}
+
+		l.processSection(section.name, block)
+	}
+}
+
+// processJSON reads a json file, which must be an object with one field per section
+func (l *configLoader) processJSON(filename string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	b = []byte(interpolate(string(b)))
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	// lineAt returns the line number of the current position in the file
+	lineAt := func() int {
+		return bytes.Count(b[:dec.InputOffset()], []byte("\n")) + 1
+	}
+
+	jsonError := func(err error) error {
+		var se *json.SyntaxError
+		if errors.As(err, &se) {
+			l.errorf(filename, bytes.Count(b[:se.Offset], []byte("\n"))+1, "%v", se)
+		} else {
+			l.errorf(filename, lineAt(), "%v", err)
+		}
+		return nil
+	}
+
+	if t, err := dec.Token(); err != nil {
+		return jsonError(err)
+	} else if t != json.Delim('{') {
+		l.errorf(filename, lineAt(), "expected a json object")
+		return nil
+	}
+
+	var sections []configSection
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return jsonError(err)
+		}
+
+		section := configSection{name: t.(string), line: lineAt()}
+		if err := dec.Decode(&section.value); err != nil {
+			return jsonError(err)
+		}
+		section.value = jsonValue(section.value)
+		sections = append(sections, section)
+	}
+
+	l.processSections(filename, sections)
+	return nil
+}
+
+// jsonValue converts json.Number into an int64 or float64 so it is marshalled to yaml as a number
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = jsonValue(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = jsonValue(e)
+		}
+	}
+	return v
+}
+
+// tomlSectionPattern matches the start of a section in a toml file, either a table or a key
+var tomlSectionPattern = regexp.MustCompile(`^\s*(?:\[\s*([^.\]\s]+)|([^=\s\[#]+)\s*=)`)
+
+// processTOML reads a toml file, where each top level table or key is a section
+func (l *configLoader) processTOML(filename string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	text := interpolate(string(b))
+
+	var doc map[string]interface{}
+	if _, err := toml.Decode(text, &doc); err != nil {
+		var pe toml.ParseError
+		if errors.As(err, &pe) {
+			l.errorf(filename, pe.Position.Line, "%s", pe.Message)
+		} else {
+			l.errorf(filename, 1, "%v", err)
+		}
+		return nil
+	}
+
+	// toml does not provide the position of each section so find where each first appears.
+	// Keys are only sections until the first table.
+	lines := make(map[string]int)
+	inTable := false
+	for i, line := range strings.Split(text, "\n") {
+		if m := tomlSectionPattern.FindStringSubmatch(line); m != nil && (m[1] != "" || !inTable) {
+			inTable = inTable || m[1] != ""
+			name := strings.Trim(m[1]+m[2], `"'`)
+			if _, exists := lines[name]; !exists {
+				lines[name] = i + 1
+			}
+		}
+	}
+
+	var sections []configSection
+	for name, value := range doc {
+		line, exists := lines[name]
+		if !exists {
+			line = 1
+		}
+		sections = append(sections, configSection{name: name, line: line, value: value})
+	}
+
+	// Process in the order they appear in the file
+	sort.Slice(sections, func(i, j int) bool {
+		if sections[i].line != sections[j].line {
+			return sections[i].line < sections[j].line
+		}
+		return sections[i].name < sections[j].name
+	})
+
+	l.processSections(filename, sections)
+	return nil
+}
@@ -0,0 +1,136 @@
+package kernel
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// configWatchFlag is the flag used to set how often the config files are checked for changes
+	configWatchFlag = "config-watch"
+)
+
+// ConfigReloadable is implemented by services which want to be notified when
+// a config section injected into them has been changed by a reload.
+//
+// When this is called the injected struct already contains the new values.
+// The section is the name of the section in the config file.
+type ConfigReloadable interface {
+	ConfigReloaded(section string) error
+}
+
+// configWatch returns the interval between checking config files for changes
+func (k *Kernel) configWatch() time.Duration {
+	if d, ok := k.flagValue(configWatchFlag).(time.Duration); ok {
+		return d
+	}
+	return 0
+}
+
+// ConfigLocker returns a Locker which services should hold whilst reading
+// injected config if it can be changed by a reload.
+func (k *Kernel) ConfigLocker() sync.Locker {
+	return k.configMutex.RLocker()
+}
+
+// ReloadConfig reloads the configuration files, updating any injected config
+// and notifying ConfigReloadable services of the sections which have changed.
+//
+// If the files cannot be read then an error is returned and the existing config is kept.
+func (k *Kernel) ReloadConfig() error {
+	dc := k.dynamicConfig()
+	if dc == nil {
+		return nil
+	}
+	return dc.reload()
+}
+
+// watch reloads the config on SIGHUP, or when any of the files have been modified
+// if -config-watch is set, until the context is cancelled.
+func (dc *dynamicConfig) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if d := dc.kernel.configWatch(); d > 0 {
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-hup:
+			dc.logReload(dc.reload())
+
+		case <-tick:
+			if dc.modified() {
+				dc.logReload(dc.reload())
+			}
+		}
+	}
+}
+
+func (dc *dynamicConfig) logReload(err error) {
+	if err != nil {
+		log.Printf("Config reload failed, keeping existing config: %v", err)
+	}
+}
+
+// modified returns true if any of the config files have changed since they were last read
+func (dc *dynamicConfig) modified() bool {
+	dc.reloadMutex.Lock()
+	defer dc.reloadMutex.Unlock()
+
+	for name, modTime := range dc.files {
+		info, err := os.Stat(name)
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload loads the config files, and if successful applies them to the
+// injected config then notifies any ConfigReloadable services.
+func (dc *dynamicConfig) reload() error {
+	dc.reloadMutex.Lock()
+	defer dc.reloadMutex.Unlock()
+
+	l, err := dc.load()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range dc.apply(l) {
+		dc.notify(name)
+	}
+	return nil
+}
+
+// notify calls ConfigReloaded on each service which has the named section injected
+func (dc *dynamicConfig) notify(name string) {
+	seen := make(map[interface{}]bool)
+	for _, ip := range dc.entries[name].injectionPoints {
+		owner := ip.Owner()
+		if seen[owner] {
+			continue
+		}
+		seen[owner] = true
+
+		if r, ok := owner.(ConfigReloadable); ok {
+			if err := r.ConfigReloaded(name); err != nil {
+				log.Printf("Service %s failed to reload config %q: %v", serviceName(owner), name, err)
+			}
+		}
+	}
+}
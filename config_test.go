@@ -0,0 +1,400 @@
+package kernel
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Level string   `yaml:"level"`
+	Rate  int      `yaml:"rate"`
+	Tags  []string `yaml:"tags"`
+}
+
+type testConfigService struct {
+	config   *testConfig `kernel:"config,limits"`
+	kernel   *Kernel
+	filename string
+	content  string
+	before   testConfig
+	sections []string
+	err      error
+}
+
+func (s *testConfigService) Init(k *Kernel) error {
+	s.kernel = k
+	return nil
+}
+
+func (s *testConfigService) Run() error {
+	s.before = *s.config
+	if err := os.WriteFile(s.filename, []byte(s.content), 0644); err != nil {
+		return err
+	}
+	s.err = s.kernel.ReloadConfig()
+	return nil
+}
+
+func (s *testConfigService) ConfigReloaded(section string) error {
+	s.sections = append(s.sections, section)
+	return nil
+}
+
+func writeTestConfig(t *testing.T, content string) string {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestDynamicConfig_Reload(t *testing.T) {
+	filename := writeTestConfig(t, "limits:\n  level: info\n  rate: 10\n  tags: [a, b]\n")
+
+	k := NewKernel()
+	k.SetArgs("-config", filename)
+
+	s := &testConfigService{filename: filename, content: "limits:\n  level: debug\n  rate: 5\n"}
+	if _, err := k.AddService(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.err != nil {
+		t.Fatal(s.err)
+	}
+
+	if s.before.Level != "info" || s.before.Rate != 10 || len(s.before.Tags) != 2 {
+		t.Errorf("initial config not loaded, got %+v", s.before)
+	}
+
+	// Values missing from the new file revert to their defaults
+	if s.config.Level != "debug" || s.config.Rate != 5 || s.config.Tags != nil {
+		t.Errorf("config not reloaded, got %+v", *s.config)
+	}
+
+	if len(s.sections) != 1 || s.sections[0] != "limits" {
+		t.Errorf("expected limits to be reloaded, got %v", s.sections)
+	}
+}
+
+func TestDynamicConfig_ReloadError(t *testing.T) {
+	filename := writeTestConfig(t, "limits:\n  level: info\n")
+
+	k := NewKernel()
+	k.SetArgs("-config", filename)
+
+	s := &testConfigService{filename: filename, content: "limits:\n  level: [unterminated\n"}
+	if _, err := k.AddService(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.err == nil {
+		t.Error("expected reload to fail")
+	}
+
+	if s.config.Level != "info" || len(s.sections) != 0 {
+		t.Errorf("expected existing config to be kept, got %+v notified %v", *s.config, s.sections)
+	}
+}
+
+type testEnvConfig struct {
+	Level string `yaml:"level"`
+	Rate  int    `yaml:"rate"`
+	Pool  struct {
+		MaxSize int
+	} `yaml:"pool"`
+}
+
+type testEnvConfigService struct {
+	config *testEnvConfig `kernel:"config,limits"`
+}
+
+func TestDynamicConfig_Env(t *testing.T) {
+	t.Setenv("TEST_LEVEL", "warn")
+	t.Setenv("TEST_RATE", "")
+	t.Setenv("TEST_LIMITS_RATE", "42")
+	t.Setenv("TEST_LIMITS_POOL_MAXSIZE", "7")
+
+	filename := writeTestConfig(t, "limits:\n  level: ${TEST_LEVEL}-${TEST_MISSING:-x}\n  rate: ${TEST_RATE:-10}\n")
+
+	k := NewKernel()
+	k.SetArgs("-config", filename)
+	k.SetEnvPrefix("TEST")
+
+	s := &testEnvConfigService{}
+	if _, err := k.AddService(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.config.Level != "warn-x" {
+		t.Errorf("expected level warn-x, got %q", s.config.Level)
+	}
+
+	if s.config.Rate != 42 {
+		t.Errorf("expected rate 42, got %d", s.config.Rate)
+	}
+
+	if s.config.Pool.MaxSize != 7 {
+		t.Errorf("expected pool max size 7, got %d", s.config.Pool.MaxSize)
+	}
+}
+
+type testValidateConfig struct {
+	Name    string        `yaml:"name" validate:"required"`
+	Workers int           `yaml:"workers" validate:"min=1,max=8"`
+	Mode    string        `yaml:"mode" validate:"omitempty,oneof=fast|safe"`
+	Timeout time.Duration `yaml:"timeout" validate:"min=1s"`
+}
+
+type testValidateService struct {
+	config *testValidateConfig `kernel:"config,app"`
+}
+
+func TestDynamicConfig_Validate(t *testing.T) {
+	filename := writeTestConfig(t, "# Test config\napp:\n  workers: 10\n\n  mode: slow\n  timeout: 2s\n  extra: true\nunknown:\n  a: b\n")
+
+	k := NewKernel()
+	k.SetArgs("-config", filename)
+	k.SetStrictConfig(true)
+
+	if _, err := k.AddService(&testValidateService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := k.Run()
+	if err == nil {
+		t.Fatal("expected config to be invalid")
+	}
+
+	for _, expected := range []string{
+		filename + ":7: field extra not found",
+		filename + ":8: unknown config section \"unknown\"",
+		filename + ":2: app.name: is required",
+		filename + ":3: app.workers: value must be at most 8",
+		filename + ":5: app.mode: \"slow\" must be one of fast, safe",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in error:\n%v", expected, err)
+		}
+	}
+
+	var ce *ConfigError
+	if !errors.As(err, &ce) {
+		t.Errorf("expected a ConfigError, got %T", err)
+	}
+}
+
+// TestDynamicConfig_ValidateBeforeStart ensures invalid config prevents services deployed before the config from starting
+func TestDynamicConfig_ValidateBeforeStart(t *testing.T) {
+	filename := writeTestConfig(t, "app:\n  workers: 10\n")
+
+	k := NewKernel()
+	k.SetArgs("-config", filename)
+
+	first := &testService{}
+	if err := k.DependsOn(first, &testValidateService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.Run(); err == nil {
+		t.Fatal("expected config to be invalid")
+	}
+
+	if first.start {
+		t.Error("service started with invalid config")
+	}
+}
+
+type testFormatService struct {
+	limits *testConfig    `kernel:"config,limits"`
+	pool   *testEnvConfig `kernel:"config,pool"`
+	name   *string        `kernel:"config,name"`
+}
+
+func TestDynamicConfig_Formats(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	if err := os.Mkdir(confDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string]string{
+		"config.yaml":         "limits:\n  level: info\n#include \"" + filepath.Join(dir, "limits.json") + "\"\n#include-dir \"" + confDir + "\"\n",
+		"limits.json":         "{\n  \"limits\": {\"rate\": 10, \"tags\": [\"a\", \"b\"]}\n}\n",
+		"conf.d/10-pool.toml": "name = \"test\"\n\n[pool]\nlevel = \"debug\"\n\n[pool.pool]\nmaxsize = 4\n",
+		"conf.d/20-pool.yaml": "pool:\n  rate: 3\n  level: warn\n",
+		"conf.d/README":       "Not a config file\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	k := NewKernel()
+	k.SetArgs("-config", filepath.Join(dir, "config.yaml"))
+	k.SetStrictConfig(true)
+
+	s := &testFormatService{}
+	if _, err := k.AddService(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.limits.Level != "info" || s.limits.Rate != 10 || len(s.limits.Tags) != 2 {
+		t.Errorf("limits not loaded from yaml and json, got %+v", *s.limits)
+	}
+
+	if s.pool.Level != "warn" || s.pool.Rate != 3 || s.pool.Pool.MaxSize != 4 {
+		t.Errorf("pool not loaded from toml and yaml, got %+v", *s.pool)
+	}
+
+	if *s.name != "test" {
+		t.Errorf("expected name test, got %q", *s.name)
+	}
+}
+
+type testSecretConfig struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password" secret:"true"`
+	Port     int    `yaml:"port"`
+	Pin      int    `yaml:"pin" secret:"true"`
+	Debug    bool   `yaml:"debug" secret:"false"`
+}
+
+type testDumpService struct {
+	db      *testSecretConfig `kernel:"config,db"`
+	started bool
+}
+
+func (s *testDumpService) Start() error {
+	s.started = true
+	return nil
+}
+
+func TestKernel_DumpConfig(t *testing.T) {
+	t.Setenv("APP_DB_PORT", "5433")
+	filename := writeTestConfig(t, "db:\n  user: admin\n  password: hunter2\n  pin: 1234\n  debug: true\n")
+
+	k := NewKernel()
+	s := &testDumpService{}
+	if _, err := k.AddService(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.FlagSet().Parse([]string{"-config", filename, "-config-dump"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := k.DumpConfig(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "db:\n" +
+		"  # " + filename + ":2\n  user: admin\n" +
+		"  # " + filename + ":3\n  password: '********'\n" +
+		"  # $APP_DB_PORT\n  port: 5433\n" +
+		"  # " + filename + ":4\n  pin: '********'\n" +
+		"  # " + filename + ":5\n  debug: true\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	// The config is printed instead of starting any services
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if s.started {
+		t.Error("service started with -config-dump")
+	}
+}
+
+type testDefaultConfig struct {
+	Level   string        `yaml:"level" default:"info"`
+	Rate    int           `yaml:"rate" default:"10"`
+	Timeout time.Duration `yaml:"timeout" default:"30s"`
+	Tags    []string      `yaml:"tags" default:"[a, b]"`
+}
+
+type testValueService struct {
+	config   testDefaultConfig  `kernel:"config,limits"`
+	shared   *testDefaultConfig `kernel:"config,limits"`
+	kernel   *Kernel
+	filename string
+	before   testDefaultConfig
+}
+
+func (s *testValueService) Init(k *Kernel) error {
+	s.kernel = k
+	return nil
+}
+
+func (s *testValueService) Run() error {
+	s.before = s.config
+	if err := os.WriteFile(s.filename, []byte("limits:\n  timeout: 5s\n"), 0644); err != nil {
+		return err
+	}
+	return s.kernel.ReloadConfig()
+}
+
+func TestDynamicConfig_ValueAndDefaults(t *testing.T) {
+	filename := writeTestConfig(t, "limits:\n  rate: 20\n")
+
+	k := NewKernel()
+	k.SetArgs("-config", filename)
+
+	s := &testValueService{filename: filename}
+	if _, err := k.AddService(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	before := testDefaultConfig{Level: "info", Rate: 20, Timeout: 30 * time.Second, Tags: []string{"a", "b"}}
+	if !reflect.DeepEqual(s.before, before) {
+		t.Errorf("expected %+v, got %+v", before, s.before)
+	}
+
+	after := testDefaultConfig{Level: "info", Rate: 10, Timeout: 5 * time.Second, Tags: []string{"a", "b"}}
+	if !reflect.DeepEqual(s.config, after) {
+		t.Errorf("expected %+v after reload, got %+v", after, s.config)
+	}
+
+	if !reflect.DeepEqual(*s.shared, after) {
+		t.Errorf("expected shared %+v after reload, got %+v", after, *s.shared)
+	}
+}
+
+type testValueInjectService struct {
+	service testService `kernel:"inject"`
+}
+
+func TestKernel_InjectValue(t *testing.T) {
+	k := NewKernel()
+	if _, err := k.AddService(&testValueInjectService{}); err == nil {
+		t.Error("expected injecting a service into a value to fail")
+	}
+}
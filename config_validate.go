@@ -0,0 +1,278 @@
+package kernel
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigError is a problem found whilst loading the config files.
+// When loading fails, every problem found is returned together with errors.Join.
+type ConfigError struct {
+	File    string // The file containing the problem, "" if not from a file
+	Line    int    // The line in File
+	Message string // Description of the problem
+}
+
+func (e *ConfigError) Error() string {
+	if e.File == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// configLocation is where a config section was defined
+type configLocation struct {
+	file string                  // File containing the section
+	line int                     // Line of the section name
+	keys map[string]configSource // Where each top level key in the section was set
+}
+
+// configSource is where a config value was set, either a file or an environment variable
+type configSource struct {
+	file string
+	line int
+	env  string
+}
+
+func (s configSource) String() string {
+	if s.env != "" {
+		return "$" + s.env
+	}
+	return fmt.Sprintf("%s:%d", s.file, s.line)
+}
+
+var (
+	durationType     = reflect.TypeOf(time.Duration(0))
+	yamlErrorPattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+)
+
+// SetStrictConfig sets whether unknown sections and keys in the config files are errors.
+// By default, they are ignored.
+func (k *Kernel) SetStrictConfig(strict bool) {
+	k.strictConfig = strict
+}
+
+func (l *configLoader) errorf(file string, line int, format string, a ...interface{}) {
+	l.errs = append(l.errs, &ConfigError{File: file, Line: line, Message: fmt.Sprintf(format, a...)})
+}
+
+// yamlError records each problem in a yaml error, mapping the line numbers in the
+// block back to those in the file.
+func (l *configLoader) yamlError(block *configBlock, err error) {
+	msgs := []string{err.Error()}
+	var te *yaml.TypeError
+	if errors.As(err, &te) {
+		msgs = te.Errors
+	}
+
+	for _, msg := range msgs {
+		if m := yamlErrorPattern.FindStringSubmatch(msg); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			l.errorf(block.file, block.line(n), "%s", m[2])
+		} else {
+			l.errorf(block.file, block.line(1), "%s", msg)
+		}
+	}
+}
+
+// location returns the location of a section, creating it if required
+func (l *configLoader) location(name string) *configLocation {
+	loc, exists := l.sections[name]
+	if !exists {
+		loc = &configLocation{keys: make(map[string]configSource)}
+		l.sections[name] = loc
+	}
+	return loc
+}
+
+// recordLocation records where a section and its top level keys are defined.
+// If a section appears more than once, the later definition takes precedence.
+func (l *configLoader) recordLocation(name string, block *configBlock) {
+	loc := l.location(name)
+	loc.file = block.file
+	loc.line = block.line(1)
+
+	// The top level keys are those with the least indentation
+	indent := -1
+	for _, line := range block.lines[1:] {
+		if i := len(line) - len(strings.TrimLeft(line, " \t")); i < len(line) && (indent < 0 || i < indent) {
+			indent = i
+		}
+	}
+
+	for i, line := range block.lines[1:] {
+		if len(line) > indent && len(line)-len(strings.TrimLeft(line, " \t")) == indent {
+			if j := strings.Index(line, ":"); j > indent {
+				loc.keys[strings.TrimSpace(line[:j])] = configSource{file: block.file, line: block.lineNos[i+1]}
+			}
+		}
+	}
+}
+
+// yamlFieldName returns the name of a struct field in yaml, false if it is excluded
+func yamlFieldName(sf reflect.StructField) (string, bool) {
+	name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return strings.ToLower(sf.Name), true
+	default:
+		return name, true
+	}
+}
+
+// validate checks the validate tags of each config section
+func (l *configLoader) validate() {
+	var names []string
+	for name := range l.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		l.validateStruct(l.sections[name], name, "", reflect.ValueOf(l.configs[name]).Elem())
+	}
+}
+
+func (l *configLoader) validateStruct(loc *configLocation, path, key string, v reflect.Value) {
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := yamlFieldName(sf)
+		if !ok || !sf.IsExported() {
+			continue
+		}
+
+		// Errors are reported against the top level key in the section
+		fieldKey := key
+		if fieldKey == "" {
+			fieldKey = name
+		}
+		fieldPath := path + "." + name
+		f := v.Field(i)
+
+		if rules, exists := sf.Tag.Lookup("validate"); exists {
+			if err := validateField(f, rules); err != nil {
+				l.validationError(loc, fieldKey, "%s: %v", fieldPath, err)
+			}
+		}
+
+		switch {
+		case f.Kind() == reflect.Struct:
+			l.validateStruct(loc, fieldPath, fieldKey, f)
+		case f.Kind() == reflect.Ptr && !f.IsNil():
+			l.validateStruct(loc, fieldPath, fieldKey, f.Elem())
+		}
+	}
+}
+
+func (l *configLoader) validationError(loc *configLocation, key string, format string, a ...interface{}) {
+	if loc == nil {
+		l.errorf("", 0, format, a...)
+		return
+	}
+
+	// Values set from the environment have no file
+	src, exists := loc.keys[key]
+	switch {
+	case !exists:
+		l.errorf(loc.file, loc.line, format, a...)
+	case src.env != "":
+		l.errorf("", 0, "%s: %s", src, fmt.Sprintf(format, a...))
+	default:
+		l.errorf(src.file, src.line, format, a...)
+	}
+}
+
+// validateField checks a field against a validate tag, e.g. "required,min=1,oneof=a|b".
+// If the tag includes omitempty then no rules are checked if the field has no value.
+func validateField(f reflect.Value, rules string) error {
+	for _, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		switch name {
+		case "":
+
+		case "omitempty":
+			if f.IsZero() {
+				return nil
+			}
+
+		case "required":
+			if f.IsZero() {
+				return errors.New("is required")
+			}
+
+		case "min", "max", "oneof":
+			if err := validateRule(f, name, param); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("unknown validation rule %q", name)
+		}
+	}
+	return nil
+}
+
+func validateRule(f reflect.Value, name, param string) error {
+	if name == "oneof" {
+		value := fmt.Sprint(f.Interface())
+		for _, option := range strings.Split(param, "|") {
+			if value == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q must be one of %s", value, strings.ReplaceAll(param, "|", ", "))
+	}
+
+	limit, err := parseLimit(f.Type(), param)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, param, err)
+	}
+
+	var value float64
+	what := "value"
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value = float64(f.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value = float64(f.Uint())
+	case reflect.Float32, reflect.Float64:
+		value = f.Float()
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		value = float64(f.Len())
+		what = "length"
+	default:
+		return fmt.Errorf("%s is not supported for %s", name, f.Type())
+	}
+
+	switch {
+	case name == "min" && value < limit:
+		return fmt.Errorf("%s must be at least %s", what, param)
+	case name == "max" && value > limit:
+		return fmt.Errorf("%s must be at most %s", what, param)
+	}
+	return nil
+}
+
+// parseLimit parses the parameter of min or max, which is a duration for time.Duration fields
+func parseLimit(t reflect.Type, param string) (float64, error) {
+	if t == durationType {
+		d, err := time.ParseDuration(param)
+		return float64(d), err
+	}
+	return strconv.ParseFloat(param, 64)
+}
@@ -0,0 +1,218 @@
+package kernel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testContextService blocks in RunContext until the root context is cancelled
+type testContextService struct {
+	started   chan struct{}
+	cancelled bool
+}
+
+func (s *testContextService) RunContext(ctx context.Context) error {
+	close(s.started)
+	<-ctx.Done()
+	s.cancelled = true
+	return ctx.Err()
+}
+
+func TestKernel_RunContextCancel(t *testing.T) {
+	s := &testContextService{started: make(chan struct{})}
+	k := NewKernel()
+	if err := k.DependsOn(s); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- k.RunContext(ctx)
+	}()
+
+	// Wait for the service to start running then cancel the kernel
+	<-s.started
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("expected clean exit got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("kernel did not exit when cancelled")
+	}
+
+	if !s.cancelled {
+		t.Errorf("service did not see cancellation")
+	}
+}
+
+// testBackgroundService starts a goroutine in StartContext which exits when the root context is cancelled
+type testBackgroundService struct {
+	exited chan struct{}
+}
+
+func (s *testBackgroundService) StartContext(ctx context.Context) error {
+	s.exited = make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(s.exited)
+	}()
+	return nil
+}
+
+// testFailingService fails in the Run phase
+type testFailingService struct{}
+
+func (s *testFailingService) Run() error {
+	return errors.New("run failed")
+}
+
+func TestKernel_RunContextCancelOnError(t *testing.T) {
+	bg := &testBackgroundService{}
+	k := NewKernel()
+	if err := k.DependsOn(bg, &testFailingService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.Run(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	select {
+	case <-bg.exited:
+	case <-time.After(time.Second):
+		t.Fatal("root context not cancelled on failure")
+	}
+}
+
+// testConcurrentService blocks until the context is cancelled
+type testConcurrentService struct {
+	testContextService
+}
+
+func (s *testConcurrentService) RunConcurrently() bool {
+	return true
+}
+
+func TestKernel_ConcurrentRun(t *testing.T) {
+	blocking := &testConcurrentService{testContextService{started: make(chan struct{})}}
+	runErr := errors.New("run failed")
+
+	k := NewKernel()
+	if err := k.DependsOn(blocking, &testService{}, &testFailingService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- k.Run()
+	}()
+
+	select {
+	case err := <-result:
+		if err == nil || err.Error() != runErr.Error() {
+			t.Errorf("expected %v got %v", runErr, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocking service was not cancelled")
+	}
+
+	if !blocking.cancelled {
+		t.Errorf("blocking service not cancelled")
+	}
+}
+
+// testBlockingService is a concurrent legacy service which blocks in Run until Stop is called
+type testBlockingService struct {
+	stop chan struct{}
+}
+
+func (s *testBlockingService) Run() error {
+	<-s.stop
+	return nil
+}
+
+func (s *testBlockingService) Stop() {
+	close(s.stop)
+}
+
+func (s *testBlockingService) RunConcurrently() bool {
+	return true
+}
+
+// testConcurrentFailingService fails in the Run phase whilst running concurrently
+type testConcurrentFailingService struct {
+	testFailingService
+}
+
+func (s *testConcurrentFailingService) RunConcurrently() bool {
+	return true
+}
+
+// TestKernel_ConcurrentRunStopsOnError ensures a failure stops the services which only return from Run once stopped
+func TestKernel_ConcurrentRunStopsOnError(t *testing.T) {
+	k := NewKernel()
+	if err := k.DependsOn(&testBlockingService{stop: make(chan struct{})}, &testConcurrentFailingService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- k.Run()
+	}()
+
+	select {
+	case err := <-result:
+		if err == nil || err.Error() != "run failed" {
+			t.Errorf("expected run failed got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocking service was not stopped")
+	}
+}
+
+// testSignalService closes ran when it has run
+type testSignalService struct {
+	ran chan struct{}
+}
+
+func (s *testSignalService) Run() error {
+	close(s.ran)
+	return nil
+}
+
+func TestKernel_SetConcurrentRun(t *testing.T) {
+	a := &testContextService{started: make(chan struct{})}
+	b := &testSignalService{ran: make(chan struct{})}
+
+	k := NewKernel()
+	k.SetConcurrentRun(true)
+	if err := k.DependsOn(a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- k.RunContext(ctx)
+	}()
+
+	// b would never run if a blocked the Run phase
+	select {
+	case <-b.ran:
+	case <-time.After(time.Second):
+		t.Errorf("service blocked by a concurrent service")
+	}
+	cancel()
+
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+}
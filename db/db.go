@@ -2,17 +2,14 @@ package db
 
 import (
 	"database/sql"
-	"flag"
 	"fmt"
 	_ "github.com/lib/pq"
-	"github.com/peter-mount/go-kernel/v2"
-	"os"
 	"time"
 )
 
 // DBService database/sql bound with github.com/lib/pq as a Kernel Service
 type DBService struct {
-	postgresURI *string
+	postgresURI *string `kernel:"flag,db,The database to connect to,,env=POSTGRESDB"`
 	db          *sql.DB
 	maxOpen     int
 	maxIdle     int
@@ -21,15 +18,7 @@ type DBService struct {
 	Debug bool
 }
 
-func (s *DBService) Init(_ *kernel.Kernel) error {
-	s.postgresURI = flag.String("db", "", "The database to connect to")
-	return nil
-}
-
 func (s *DBService) Start() error {
-	if *s.postgresURI == "" {
-		*s.postgresURI = os.Getenv("POSTGRESDB")
-	}
 	if *s.postgresURI == "" {
 		return fmt.Errorf("No database uri provided")
 	}
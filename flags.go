@@ -1,46 +1,117 @@
 package kernel
 
 import (
+	"encoding"
 	"flag"
+	"fmt"
 	"github.com/peter-mount/go-kernel/v2/util/injection"
 	"reflect"
 	"strconv"
+	"strings"
+	"time"
 )
 
-// injectFlag - kernel:"flag:name:desc:default" - default is optional
+var (
+	flagValueType       = reflect.TypeOf((*flag.Value)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	stringSliceType     = reflect.TypeOf([]string(nil))
+)
+
+// injectFlag - kernel:"flag:name:desc:default:options..." - default and options are optional
 func (k *Kernel) injectFlag(tags []string, ip *injection.Point) error {
+	if ip.StructField().Type.Kind() != reflect.Ptr {
+		return ip.Errorf("must be a pointer")
+	}
+
+	if err := k.bindFlag(tags, ip); err != nil {
+		return err
+	}
+
+	// Types with their own parsing take precedence over their underlying kind
+	switch t := ip.Type(); {
+	case t == durationType:
+		v, err := time.ParseDuration(getFlagDefault(tags, "0s"))
+		if err != nil {
+			return ip.Error(err)
+		}
+		ip.Set(k.FlagSet().Duration(getFlagName(tags, ip), v, getFlagDesc(tags, ip)))
+		return nil
+
+	case reflect.PointerTo(t).Implements(flagValueType):
+		v := reflect.New(t)
+		if err := setFlagDefault(v.Interface().(flag.Value), tags); err != nil {
+			return ip.Error(err)
+		}
+		k.FlagSet().Var(v.Interface().(flag.Value), getFlagName(tags, ip), getFlagDesc(tags, ip))
+		ip.Set(v.Interface())
+		return nil
+
+	case reflect.PointerTo(t).Implements(textUnmarshalerType):
+		v := reflect.New(t)
+		fv := &textValue{v: v.Interface().(encoding.TextUnmarshaler)}
+		if err := setFlagDefault(fv, tags); err != nil {
+			return ip.Error(err)
+		}
+		k.FlagSet().Var(fv, getFlagName(tags, ip), getFlagDesc(tags, ip))
+		ip.Set(v.Interface())
+		return nil
+
+	case t == stringSliceType:
+		v := &stringSliceValue{}
+		if d := getFlagDefault(tags, ""); d != "" {
+			v.values = strings.Fields(d)
+		}
+		k.FlagSet().Var(v, getFlagName(tags, ip), getFlagDesc(tags, ip))
+		ip.Set(&v.values)
+		return nil
+	}
+
 	switch ip.Type().Kind() {
 	case reflect.Bool:
 		v, err := strconv.ParseBool(getFlagDefault(tags, "false"))
 		if err != nil {
 			return ip.Error(err)
 		}
-		ip.Set(flag.Bool(getFlagName(tags, ip), v, getFlagDesc(tags, ip)))
+		ip.Set(k.FlagSet().Bool(getFlagName(tags, ip), v, getFlagDesc(tags, ip)))
 
 	case reflect.String:
 		v := getFlagDefault(tags, "")
-		ip.Set(flag.String(getFlagName(tags, ip), v, getFlagDesc(tags, ip)))
+		ip.Set(k.FlagSet().String(getFlagName(tags, ip), v, getFlagDesc(tags, ip)))
 
 	case reflect.Int:
 		v, err := strconv.ParseInt(getFlagDefault(tags, "0"), 10, 64)
 		if err != nil {
 			return ip.Error(err)
 		}
-		ip.Set(flag.Int(getFlagName(tags, ip), int(v), getFlagDesc(tags, ip)))
+		ip.Set(k.FlagSet().Int(getFlagName(tags, ip), int(v), getFlagDesc(tags, ip)))
 
 	case reflect.Int64:
 		v, err := strconv.ParseInt(getFlagDefault(tags, "0"), 10, 64)
 		if err != nil {
 			return ip.Error(err)
 		}
-		ip.Set(flag.Int64(getFlagName(tags, ip), v, getFlagDesc(tags, ip)))
+		ip.Set(k.FlagSet().Int64(getFlagName(tags, ip), v, getFlagDesc(tags, ip)))
+
+	case reflect.Uint:
+		v, err := strconv.ParseUint(getFlagDefault(tags, "0"), 10, 64)
+		if err != nil {
+			return ip.Error(err)
+		}
+		ip.Set(k.FlagSet().Uint(getFlagName(tags, ip), uint(v), getFlagDesc(tags, ip)))
+
+	case reflect.Uint64:
+		v, err := strconv.ParseUint(getFlagDefault(tags, "0"), 10, 64)
+		if err != nil {
+			return ip.Error(err)
+		}
+		ip.Set(k.FlagSet().Uint64(getFlagName(tags, ip), v, getFlagDesc(tags, ip)))
 
 	case reflect.Float64:
 		v, err := strconv.ParseFloat(getFlagDefault(tags, "0.0"), 64)
 		if err != nil {
 			return ip.Error(err)
 		}
-		ip.Set(flag.Float64(getFlagName(tags, ip), v, getFlagDesc(tags, ip)))
+		ip.Set(k.FlagSet().Float64(getFlagName(tags, ip), v, getFlagDesc(tags, ip)))
 
 	default:
 		return ip.Errorf("unsupported flag type %q", ip.Type())
@@ -69,3 +140,95 @@ func getFlagDefault(tags []string, d string) string {
 	}
 	return d
 }
+
+// setFlagDefault sets a flag.Value to the default in the tag, if present
+func setFlagDefault(v flag.Value, tags []string) error {
+	if d := getFlagDefault(tags, ""); d != "" {
+		return v.Set(d)
+	}
+	return nil
+}
+
+// declareFlag adds one of the kernel's own flags to a FlagSet, with value as its default.
+// As the singleton kernel is reset on every Launch, this only declares it if it's not already present.
+func declareFlag(flags *flag.FlagSet, name string, value interface{}, usage string) {
+	if flags.Lookup(name) != nil {
+		return
+	}
+
+	switch v := value.(type) {
+	case bool:
+		flags.Bool(name, v, usage)
+	case string:
+		flags.String(name, v, usage)
+	case time.Duration:
+		flags.Duration(name, v, usage)
+	default:
+		panic(fmt.Sprintf("unsupported flag type %T", value))
+	}
+}
+
+// flagValue returns the current value of a flag in the kernel's FlagSets, nil if not present
+func (k *Kernel) flagValue(name string) interface{} {
+	for _, fs := range k.flagSets() {
+		if f := fs.Lookup(name); f != nil {
+			if g, ok := f.Value.(flag.Getter); ok {
+				return g.Get()
+			}
+		}
+	}
+	return nil
+}
+
+// textValue is a flag.Value for a type implementing encoding.TextUnmarshaler
+type textValue struct {
+	v encoding.TextUnmarshaler
+}
+
+func (t *textValue) Set(s string) error {
+	return t.v.UnmarshalText([]byte(s))
+}
+
+func (t *textValue) Get() interface{} {
+	return t.v
+}
+
+func (t *textValue) String() string {
+	// flag.isZeroValue calls this on a zero textValue
+	if t == nil || t.v == nil {
+		return ""
+	}
+	if m, ok := t.v.(encoding.TextMarshaler); ok {
+		if b, err := m.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(t.v)
+}
+
+// stringSliceValue is a flag.Value for a []string, where the flag can be repeated to add more values.
+// Any default values are replaced when the flag is first used.
+type stringSliceValue struct {
+	values []string
+	set    bool
+}
+
+func (s *stringSliceValue) Set(v string) error {
+	if !s.set {
+		s.values = nil
+		s.set = true
+	}
+	s.values = append(s.values, v)
+	return nil
+}
+
+func (s *stringSliceValue) Get() interface{} {
+	return s.values
+}
+
+func (s *stringSliceValue) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(s.values, " ")
+}
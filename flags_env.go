@@ -0,0 +1,224 @@
+package kernel
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/peter-mount/go-kernel/v2/util/injection"
+	"os"
+	"strings"
+)
+
+const (
+	// defaultFlagEnvPrefix is the prefix of the environment variable every flag can be set from.
+	// This differs from defaultEnvPrefix so a flag and a config field cannot share the same variable.
+	defaultFlagEnvPrefix = "FLAG"
+)
+
+// SetFlagEnvPrefix sets the prefix of the environment variable every flag can be set from when not on the command line.
+// The default is "FLAG" so -rest-port is set by FLAG_REST_PORT. This should differ from the prefix set with
+// SetEnvPrefix, otherwise a flag and a config field can be set by the same variable.
+func (k *Kernel) SetFlagEnvPrefix(prefix string) {
+	k.flagPrefix = prefix
+}
+
+// SetFlagEnv sets the environment variable a flag is set from before the one with the FLAG prefix.
+// This is the same as the env= option of the kernel:"flag" tag, for flags declared with the flag package.
+func (k *Kernel) SetFlagEnv(name, env string) {
+	b := k.flagBindings[name]
+	b.env = env
+	k.flagBindings[name] = b
+}
+
+// flagBinding is where a flag gets its value from when not set on the command line
+type flagBinding struct {
+	env    string // Environment variable from the env= option
+	config string // Config key from the config= option, section.key
+}
+
+// bindFlag records any env= or config= options in the tag of a flag,
+// e.g. kernel:"flag,port,Port to listen on,8080,env=PORT,config=server.port"
+func (k *Kernel) bindFlag(tags []string, ip *injection.Point) error {
+	if len(tags) < 4 {
+		return nil
+	}
+
+	var b flagBinding
+	for _, opt := range tags[3:] {
+		name, value, _ := strings.Cut(opt, "=")
+		switch {
+		case name == "env" && value != "":
+			b.env = value
+
+		case name == "config" && value != "":
+			b.config = value
+			section, _, _ := strings.Cut(value, ".")
+
+			// Config requires dynamicConfig to be deployed
+			sv, err := k.deploy(&dynamicConfig{})
+			if err != nil {
+				return err
+			}
+			dc := sv.(*dynamicConfig)
+			if dc.flagSections == nil {
+				dc.flagSections = make(map[string]bool)
+			}
+			dc.flagSections[section] = true
+
+		default:
+			return ip.Errorf("unsupported flag option %q", opt)
+		}
+	}
+
+	k.flagBindings[getFlagName(tags, ip)] = b
+	return nil
+}
+
+// flagEnvNames returns the environment variables a flag can be set from in order of precedence
+func (k *Kernel) flagEnvNames(name string) []string {
+	var names []string
+	if env := k.flagBindings[name].env; env != "" {
+		names = append(names, env)
+	}
+	return append(names, envName(k.flagPrefix+"_"+name))
+}
+
+// applyFlagFallbacks sets any flag not set on the command line from the environment, or from the config files.
+// The order of precedence is command line, environment, config then the flag's default.
+func (k *Kernel) applyFlagFallbacks() error {
+	for _, fs := range k.flagSets() {
+		if err := k.applyFlagSetFallbacks(fs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k *Kernel) applyFlagSetFallbacks(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] {
+			return
+		}
+
+		for _, env := range k.flagEnvNames(f.Name) {
+			if value, exists := os.LookupEnv(env); exists {
+				if err := fs.Set(f.Name, value); err != nil {
+					errs = append(errs, fmt.Errorf("invalid value %q for $%s: %w", value, env, err))
+				}
+				set[f.Name] = true
+				return
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	return k.applyFlagConfig(fs, set)
+}
+
+// applyFlagConfig sets any flag not already set from a key in the config files
+func (k *Kernel) applyFlagConfig(fs *flag.FlagSet, set map[string]bool) error {
+	var values map[string]interface{}
+
+	for name, b := range k.flagBindings {
+		if b.config == "" || set[name] || fs.Lookup(name) == nil {
+			continue
+		}
+
+		// Load the config on first use
+		if values == nil {
+			v, err := k.dynamicConfig().loadValues()
+			if err != nil {
+				return err
+			}
+			values = v
+		}
+
+		value, exists := configValue(values, b.config)
+		if !exists {
+			continue
+		}
+
+		// A list sets the flag once for each entry, e.g. for a []string
+		entries, isList := value.([]interface{})
+		if !isList {
+			entries = []interface{}{value}
+		}
+		for _, e := range entries {
+			if err := fs.Set(name, fmt.Sprint(e)); err != nil {
+				return fmt.Errorf("invalid value %v for -%s from config %s: %w", e, name, b.config, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValue returns the value of a key like section.key.subkey in the raw config
+func configValue(values map[string]interface{}, key string) (interface{}, bool) {
+	parts := strings.Split(key, ".")
+	v, exists := values[parts[0]]
+	for _, part := range parts[1:] {
+		if !exists {
+			break
+		}
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil, false
+		}
+		v, exists = m[part]
+	}
+	return v, exists && v != nil
+}
+
+// PeekFlag returns the value of a flag before the command line has been parsed, e.g. from a BeforeParseService,
+// falling back to its environment variable. This returns "" if not set.
+//
+// Only the flags before the first non-flag argument, e.g. a command, are searched.
+func (k *Kernel) PeekFlag(name string) string {
+	for i := 0; i < len(k.args); i++ {
+		arg := k.args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+
+		n, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if n == name {
+			if hasValue {
+				return value
+			}
+			if i+1 < len(k.args) {
+				return k.args[i+1]
+			}
+			break
+		}
+
+		// Skip the value of any other flag so it's not mistaken for a command
+		if !hasValue && i+1 < len(k.args) && flagTakesValue(k.flags.Lookup(n), k.args[i+1]) {
+			i++
+		}
+	}
+
+	for _, env := range k.flagEnvNames(name) {
+		if value, exists := os.LookupEnv(env); exists {
+			return value
+		}
+	}
+	return ""
+}
+
+// flagTakesValue returns true if a flag set without "=" uses the next argument as its value.
+// A flag which has not been declared, e.g. one from a plugin, is assumed to if next is not a flag.
+func flagTakesValue(f *flag.Flag, next string) bool {
+	if f == nil {
+		return !strings.HasPrefix(next, "-")
+	}
+	bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !bf.IsBoolFlag()
+}
@@ -0,0 +1,213 @@
+package kernel
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLevel is a custom flag.Value
+type testLevel int
+
+func (l *testLevel) Set(s string) error {
+	switch strings.ToLower(s) {
+	case "debug":
+		*l = 1
+	case "info":
+		*l = 2
+	default:
+		*l = 0
+	}
+	return nil
+}
+
+func (l *testLevel) String() string {
+	return []string{"none", "debug", "info"}[*l]
+}
+
+type testFlagTypesService struct {
+	timeout  *time.Duration `kernel:"flag,timeout,Timeout,30s"`
+	count    *uint          `kernel:"flag,count,Count,3"`
+	size     *uint64        `kernel:"flag,size"`
+	include  *[]string      `kernel:"flag,include,Paths to include"`
+	exclude  *[]string      `kernel:"flag,exclude,Paths to exclude,tmp cache"`
+	level    *testLevel     `kernel:"flag,level,Log level,info"`
+	address  *net.IP        `kernel:"flag,address,Address to bind to,127.0.0.1"`
+	listener *net.IP        `kernel:"flag,listener"`
+}
+
+func (s *testFlagTypesService) Start() error {
+	return nil
+}
+
+func TestFlag_Types(t *testing.T) {
+	s := &testFlagTypesService{}
+	k := NewKernel()
+	k.SetArgs("-timeout", "5m", "-size", "1024", "-include", "a", "-include", "b", "-level", "debug", "-listener", "::1")
+	if _, err := k.AddService(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if *s.timeout != 5*time.Minute {
+		t.Errorf("expected timeout 5m, got %v", *s.timeout)
+	}
+	if *s.count != 3 || *s.size != 1024 {
+		t.Errorf("expected count 3 size 1024, got %d %d", *s.count, *s.size)
+	}
+	if !reflect.DeepEqual(*s.include, []string{"a", "b"}) {
+		t.Errorf("expected include [a b], got %v", *s.include)
+	}
+	if !reflect.DeepEqual(*s.exclude, []string{"tmp", "cache"}) {
+		t.Errorf("expected exclude default [tmp cache], got %v", *s.exclude)
+	}
+	if *s.level != 1 {
+		t.Errorf("expected level debug, got %v", s.level)
+	}
+	if !s.address.Equal(net.ParseIP("127.0.0.1")) || !s.listener.Equal(net.ParseIP("::1")) {
+		t.Errorf("expected addresses 127.0.0.1 and ::1, got %v %v", *s.address, *s.listener)
+	}
+
+	// Usage must be able to show the defaults of each type
+	var buf bytes.Buffer
+	k.FlagSet().SetOutput(&buf)
+	k.FlagSet().PrintDefaults()
+	if !strings.Contains(buf.String(), "(default 127.0.0.1)") {
+		t.Errorf("expected default address in usage, got:\n%s", buf.String())
+	}
+}
+
+type testFlagValueService struct {
+	timeout time.Duration `kernel:"flag,timeout"`
+}
+
+func TestFlag_Value(t *testing.T) {
+	if _, err := NewKernel().AddService(&testFlagValueService{}); err == nil {
+		t.Error("expected a flag which is not a pointer to fail")
+	}
+}
+
+type testFlagFallbackService struct {
+	cli     *string   `kernel:"flag,cli,,default,env=TEST_CLI,config=server.cli"`
+	env     *string   `kernel:"flag,env,,default,env=TEST_ENV,config=server.env"`
+	auto    *int      `kernel:"flag,auto-port,,0,config=server.port"`
+	config  *int      `kernel:"flag,port,,80,config=server.port"`
+	hosts   *[]string `kernel:"flag,hosts,,,config=server.hosts"`
+	missing *string   `kernel:"flag,missing,,default,config=server.missing"`
+}
+
+func (s *testFlagFallbackService) Start() error {
+	return nil
+}
+
+func TestFlag_Fallback(t *testing.T) {
+	t.Setenv("TEST_CLI", "env")
+	t.Setenv("TEST_ENV", "env")
+	t.Setenv("FLAG_AUTO_PORT", "8081")
+
+	filename := writeTestConfig(t, "server:\n  cli: config\n  env: config\n  port: 8080\n  hosts:\n    - a\n    - b\n")
+
+	s := &testFlagFallbackService{}
+	k := NewKernel()
+	k.SetArgs("-config", filename, "-cli", "cli")
+	k.SetStrictConfig(true)
+	if _, err := k.AddService(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if *s.cli != "cli" || *s.env != "env" || *s.auto != 8081 || *s.config != 8080 || *s.missing != "default" {
+		t.Errorf("expected cli env 8081 8080 default, got %s %s %d %d %s", *s.cli, *s.env, *s.auto, *s.config, *s.missing)
+	}
+
+	if !reflect.DeepEqual(*s.hosts, []string{"a", "b"}) {
+		t.Errorf("expected hosts [a b], got %v", *s.hosts)
+	}
+}
+
+type testFlagEnvConfig struct {
+	Port int `yaml:"port"`
+}
+
+type testFlagEnvService struct {
+	port   *int               `kernel:"flag,rest-port,,80"`
+	config *testFlagEnvConfig `kernel:"config,rest"`
+}
+
+// TestFlag_EnvPrefix ensures the environment variables of flags and config fields with the same name do not collide
+func TestFlag_EnvPrefix(t *testing.T) {
+	t.Setenv("APP_REST_PORT", "8080")
+
+	s := &testFlagEnvService{}
+	k := NewKernel()
+	k.SetArgs("-config", writeTestConfig(t, "rest:\n  port: 1\n"))
+	if _, err := k.AddService(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if *s.port != 80 || s.config.Port != 8080 {
+		t.Errorf("expected flag 80 config 8080, got %d %d", *s.port, s.config.Port)
+	}
+
+	t.Setenv("FLAG_REST_PORT", "8081")
+
+	s = &testFlagEnvService{}
+	k = NewKernel()
+	k.SetArgs("-config", writeTestConfig(t, "rest:\n  port: 1\n"))
+	if _, err := k.AddService(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if *s.port != 8081 || s.config.Port != 8080 {
+		t.Errorf("expected flag 8081 config 8080, got %d %d", *s.port, s.config.Port)
+	}
+}
+
+// TestKernel_PeekFlag ensures a flag can be read before the command line is parsed, but not after a command
+func TestKernel_PeekFlag(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{args: nil, expected: ""},
+		{args: []string{"-data", "dir"}, expected: "dir"},
+		{args: []string{"--data=dir"}, expected: "dir"},
+		{args: []string{"-port", "8080", "-data", "dir", "serve"}, expected: "dir"},
+		{args: []string{"-verbose", "-data", "dir"}, expected: "dir"},
+		{args: []string{"-verbose", "serve", "-data", "dir"}, expected: ""},
+		{args: []string{"-shutdown-timeout", "5s", "-data", "dir"}, expected: "dir"},
+		{args: []string{"serve", "-data", "dir"}, expected: ""},
+		{args: []string{"-port", "8080", "serve", "-data", "dir"}, expected: ""},
+		{args: []string{"--", "-data", "dir"}, expected: ""},
+		{args: []string{"-data-other", "dir"}, expected: ""},
+	}
+
+	for _, test := range tests {
+		k := NewKernel()
+		k.FlagSet().Bool("verbose", false, "Verbose")
+		k.SetArgs(test.args...)
+		if got := k.PeekFlag("data"); got != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.args, test.expected, got)
+		}
+	}
+
+	t.Setenv("FLAG_DATA", "envdir")
+	if got := NewKernel().PeekFlag("data"); got != "envdir" {
+		t.Errorf("expected envdir from environment, got %q", got)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/peter-mount/go-kernel/v2
 go 1.24
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/gorilla/handlers v1.5.2
 	github.com/gorilla/mux v1.8.1
 	github.com/lib/pq v1.10.9
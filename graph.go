@@ -0,0 +1,169 @@
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// graphFlag is the flag used to print the dependency graph instead of running the kernel
+	graphFlag = "kernel-graph"
+)
+
+// Dependency is an edge in the dependency graph, recording that one service caused another to be deployed.
+type Dependency struct {
+	From  string `json:"from"`            // Name of the dependent service
+	To    string `json:"to"`              // Name of the service it depends on
+	Field string `json:"field,omitempty"` // Struct field that was injected, "" if added by AddService
+	Tag   string `json:"tag,omitempty"`   // The kernel tag on that field
+}
+
+// Graph is a snapshot of the services deployed in a Kernel and the dependencies between them.
+type Graph struct {
+	Services     []string     `json:"services"`     // Service names in the order they are started
+	Dependencies []Dependency `json:"dependencies"` // Dependencies in the order they were resolved
+}
+
+// dependencyRef is the field being injected whilst a dependency is being resolved
+type dependencyRef struct {
+	field string
+	tag   string
+}
+
+func (k *Kernel) graphFormat() string {
+	format, _ := k.flagValue(graphFlag).(string)
+	return format
+}
+
+// recordDependency records that the service currently being deployed depends on the named service.
+// If the dependency comes from an injected field then that field is recorded against it.
+//
+// The returned Dependency has an empty From if this is a top level service.
+func (k *Kernel) recordDependency(name string) Dependency {
+	via := k.via
+	k.via = nil
+
+	d := Dependency{To: name}
+	if via != nil {
+		d.Field = via.field
+		d.Tag = via.tag
+	}
+
+	// Top level services have no dependents
+	if len(k.deploying) > 0 {
+		d.From = k.deploying[len(k.deploying)-1].To
+		k.graph = append(k.graph, d)
+	}
+
+	return d
+}
+
+// Graph returns a snapshot of the dependency graph of the services deployed in this Kernel.
+// This can be called whilst the kernel is running, when services can still be deployed lazily.
+func (k *Kernel) Graph() *Graph {
+	// Lazy injection can deploy services and record dependencies whilst the kernel is running
+	k.lazyMutex.Lock()
+	defer k.lazyMutex.Unlock()
+	k.indexMutex.RLock()
+	defer k.indexMutex.RUnlock()
+
+	// Services can be registered under multiple names, e.g. APIs, so pick one consistently
+	names := make(map[Service]string)
+	for name, s := range k.index {
+		if n, exists := names[s]; !exists || name < n {
+			names[s] = name
+		}
+	}
+
+	g := &Graph{}
+	k.services.ForEach(func(s Service) {
+		g.Services = append(g.Services, names[s])
+	})
+	g.Dependencies = append(g.Dependencies, k.graph...)
+	return g
+}
+
+// Write writes the graph in the named format, either "dot" or "json".
+func (g *Graph) Write(w io.Writer, format string) error {
+	switch format {
+	case "dot":
+		return g.WriteDot(w)
+	case "json":
+		return g.WriteJSON(w)
+	default:
+		return fmt.Errorf("unsupported graph format %q", format)
+	}
+}
+
+// WriteJSON writes the graph as JSON
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// WriteDot writes the graph in the graphviz dot format
+func (g *Graph) WriteDot(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "digraph kernel {"); err != nil {
+		return err
+	}
+
+	for _, s := range g.Services {
+		if _, err := fmt.Fprintf(w, "  %q;\n", s); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range g.Dependencies {
+		var err error
+		if d.Field == "" {
+			_, err = fmt.Fprintf(w, "  %q -> %q;\n", d.From, d.To)
+		} else {
+			_, err = fmt.Fprintf(w, "  %q -> %q [label=%q];\n", d.From, d.To, d.Field+" "+d.Tag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// CycleError is returned when a circular dependency is found between services.
+type CycleError struct {
+	// Path is each hop in the cycle, starting and ending with the same service
+	Path []Dependency
+}
+
+func (e *CycleError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("Circular dependency ")
+	for _, d := range e.Path {
+		sb.WriteString(d.From)
+		if d.Field != "" {
+			sb.WriteString(".")
+			sb.WriteString(d.Field)
+		}
+		sb.WriteString(" -> ")
+	}
+	if len(e.Path) > 0 {
+		sb.WriteString(e.Path[len(e.Path)-1].To)
+	}
+	return sb.String()
+}
+
+// cycleError creates a CycleError for a dependency back to a service currently being deployed
+func (k *Kernel) cycleError(d Dependency) error {
+	e := &CycleError{}
+	for i := len(k.deploying) - 1; i >= 0; i-- {
+		if k.deploying[i].To == d.To {
+			e.Path = append(e.Path, k.deploying[i+1:]...)
+			break
+		}
+	}
+	e.Path = append(e.Path, d)
+	return e
+}
@@ -0,0 +1,123 @@
+package kernel
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testGraphLeaf struct{}
+
+type testGraphRoot struct {
+	leaf *testGraphLeaf `kernel:"inject"`
+}
+
+func (s *testGraphRoot) Init(k *Kernel) error {
+	_, err := k.AddService(&testService{})
+	return err
+}
+
+func TestKernel_Graph(t *testing.T) {
+	k := NewKernel()
+	if err := k.DependsOn(&testGraphRoot{}); err != nil {
+		t.Fatal(err)
+	}
+
+	root := getServiceName(reflect.TypeOf(&testGraphRoot{}).Elem())
+	leaf := getServiceName(reflect.TypeOf(&testGraphLeaf{}).Elem())
+
+	g := k.Graph()
+
+	expected := []string{leaf, "testService", root}
+	if strings.Join(g.Services, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected services %v got %v", expected, g.Services)
+	}
+
+	expectedDeps := []Dependency{
+		{From: root, To: leaf, Field: "leaf", Tag: "inject"},
+		{From: root, To: "testService"},
+	}
+	if len(g.Dependencies) != len(expectedDeps) {
+		t.Fatalf("expected %v got %v", expectedDeps, g.Dependencies)
+	}
+	for i, d := range expectedDeps {
+		if g.Dependencies[i] != d {
+			t.Errorf("dependency %d expected %v got %v", i, d, g.Dependencies[i])
+		}
+	}
+
+	var dot bytes.Buffer
+	if err := g.Write(&dot, "dot"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dot.String(), `"`+root+`" -> "`+leaf+`" [label="leaf inject"];`) {
+		t.Errorf("dot output missing edge:\n%s", dot.String())
+	}
+
+	var js bytes.Buffer
+	if err := g.Write(&js, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var g2 Graph
+	if err := json.Unmarshal(js.Bytes(), &g2); err != nil {
+		t.Fatal(err)
+	}
+	if len(g2.Dependencies) != len(expectedDeps) {
+		t.Errorf("json round trip failed:\n%s", js.String())
+	}
+}
+
+func TestKernel_GraphFlag(t *testing.T) {
+	s := &testService{}
+	k := NewKernel()
+	k.SetArgs("-kernel-graph", "json")
+	if err := k.DependsOn(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.start || s.run {
+		t.Errorf("kernel ran when printing graph")
+	}
+}
+
+// testGraphLazy resolves its dependency lazily whilst the kernel is running
+type testGraphLazy struct {
+	leaf func() *testGraphLeaf `kernel:"inject,lazy"`
+}
+
+func (s *testGraphLazy) Run() error {
+	s.leaf()
+	return nil
+}
+
+// TestKernel_GraphRunning ensures the graph can be read whilst services are deployed lazily, run with -race
+func TestKernel_GraphRunning(t *testing.T) {
+	k := NewKernel()
+	if err := k.DependsOn(&testGraphLazy{}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			k.Graph()
+			k.dynamicConfig()
+		}
+	}()
+
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	leaf := getServiceName(reflect.TypeOf(&testGraphLeaf{}).Elem())
+	if g := k.Graph(); g.Services[len(g.Services)-1] != leaf {
+		t.Errorf("lazy dependency missing from graph %v", g.Services)
+	}
+}
@@ -0,0 +1,76 @@
+package kernel
+
+import (
+	"context"
+)
+
+// HealthStatus is the health of a single service
+type HealthStatus struct {
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// Healthy returns a HealthStatus for a healthy service
+func Healthy() HealthStatus {
+	return HealthStatus{Healthy: true}
+}
+
+// Unhealthy returns a HealthStatus for an unhealthy service with a message describing why
+func Unhealthy(message string) HealthStatus {
+	return HealthStatus{Message: message}
+}
+
+// HealthCheckService is a Service which can report its own health once it has started
+type HealthCheckService interface {
+	// Health returns the current health of the service.
+	// It should return promptly, ctx is cancelled if the caller gives up waiting.
+	Health(ctx context.Context) HealthStatus
+}
+
+// ServiceHealth is the health of a named service within a HealthReport
+type ServiceHealth struct {
+	Name string `json:"name"` // Name() of a NamedService, otherwise its type, e.g. "rest.Server"
+	HealthStatus
+}
+
+// HealthReport is the combined health of every HealthCheckService in a Kernel
+type HealthReport struct {
+	Phase    Phase           `json:"phase"`   // The current lifecycle phase
+	Ready    bool            `json:"ready"`   // true if in the Run phase and healthy
+	Healthy  bool            `json:"healthy"` // true if every service is healthy
+	Services []ServiceHealth `json:"services,omitempty"`
+}
+
+// collectHealthChecks finds the deployed services which can report their health
+func (k *Kernel) collectHealthChecks() {
+	k.services.ForEach(func(s Service) {
+		if hc, ok := s.(HealthCheckService); ok {
+			k.healthChecks = append(k.healthChecks, hc)
+		}
+	})
+}
+
+// Health returns the combined health of every deployed HealthCheckService.
+//
+// Services are only checked once the kernel has reached the Run phase, as until then they may not
+// have started. The kernel is ready only when it's in the Run phase and every service is healthy.
+// Services deployed by lazy injection are not included.
+func (k *Kernel) Health(ctx context.Context) *HealthReport {
+	k.mutex.Lock()
+	phase := k.phase
+	k.mutex.Unlock()
+
+	report := &HealthReport{Phase: phase, Healthy: true}
+	if phase != PhaseRun {
+		return report
+	}
+
+	for _, hc := range k.healthChecks {
+		status := hc.Health(ctx)
+		report.Services = append(report.Services, ServiceHealth{Name: displayName(hc), HealthStatus: status})
+		report.Healthy = report.Healthy && status.Healthy
+	}
+
+	report.Ready = report.Healthy
+	return report
+}
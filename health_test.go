@@ -0,0 +1,61 @@
+package kernel
+
+import (
+	"context"
+	"testing"
+)
+
+// testHealthService reports its health and checks the kernel report whilst running
+type testHealthService struct {
+	k       *Kernel
+	healthy bool
+	report  *HealthReport
+}
+
+func (s *testHealthService) Init(k *Kernel) error {
+	s.k = k
+	return nil
+}
+
+func (s *testHealthService) Health(_ context.Context) HealthStatus {
+	if s.healthy {
+		return Healthy()
+	}
+	return Unhealthy("not healthy")
+}
+
+func (s *testHealthService) Run() error {
+	s.report = s.k.Health(context.Background())
+	return nil
+}
+
+func TestKernel_Health(t *testing.T) {
+	for _, healthy := range []bool{true, false} {
+		s := &testHealthService{healthy: healthy}
+		k := NewKernel()
+		if err := k.DependsOn(s); err != nil {
+			t.Fatal(err)
+		}
+
+		if r := k.Health(context.Background()); r.Ready {
+			t.Errorf("kernel ready before running")
+		}
+
+		if err := k.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		r := s.report
+		if r.Phase != PhaseRun || r.Healthy != healthy || r.Ready != healthy {
+			t.Errorf("healthy=%v unexpected report %+v", healthy, r)
+		}
+
+		if len(r.Services) != 1 || r.Services[0].Healthy != healthy || r.Services[0].Name != "kernel.testHealthService" {
+			t.Errorf("healthy=%v unexpected services %+v", healthy, r.Services)
+		}
+
+		if r := k.Health(context.Background()); r.Ready {
+			t.Errorf("kernel ready after stopping")
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package kernel
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DescribedService is a service which describes itself in the help generated by the kernel
+type DescribedService interface {
+	Describe() string
+}
+
+// kernelFlags are the flags declared by the kernel itself
+var kernelFlags = []string{shutdownTimeoutFlag, graphFlag}
+
+// recordFlagOwners records s as the owner of any flags declared since before was taken
+func (k *Kernel) recordFlagOwners(s Service, before map[string]bool) {
+	k.FlagSet().VisitAll(func(f *flag.Flag) {
+		if _, owned := k.flagOwners[f.Name]; !owned && !before[f.Name] {
+			k.flagOwners[f.Name] = s
+		}
+	})
+}
+
+// flagNames returns the names of the flags currently declared
+func (k *Kernel) flagNames() map[string]bool {
+	names := make(map[string]bool)
+	k.FlagSet().VisitAll(func(f *flag.Flag) {
+		names[f.Name] = true
+	})
+	return names
+}
+
+// usage is used as the Usage of the kernel's FlagSets
+func (k *Kernel) usage() {
+	k.WriteHelp(k.FlagSet().Output())
+}
+
+// WriteHelp writes the help for the application. This lists the flags and config sections grouped by the service
+// which declared them, the environment variables each can be set from, and the available commands.
+//
+// This is what is shown with -h.
+func (k *Kernel) WriteHelp(w io.Writer) {
+	name := filepath.Base(k.flags.Name())
+	switch {
+	case k.command != nil:
+		fmt.Fprintf(w, "Usage: %s [flags] %s [flags] [args]\n", name, k.command.name)
+	case len(k.commands) > 0:
+		fmt.Fprintf(w, "Usage: %s [flags] command [flags] [args]\n\nCommands:\n", name)
+		for _, c := range k.commandNames() {
+			fmt.Fprintf(w, "  %-16s %s\n", c, k.commands[c].description)
+		}
+	default:
+		fmt.Fprintf(w, "Usage: %s [flags] [args]\n", name)
+	}
+
+	// Group the flags by the service which declared them
+	flags := make(map[Service][]*flag.Flag)
+	var kernel, other []*flag.Flag
+	for _, fs := range k.flagSets() {
+		fs.VisitAll(func(f *flag.Flag) {
+			if s, owned := k.flagOwners[f.Name]; owned && s != nil {
+				flags[s] = append(flags[s], f)
+			} else if owned {
+				kernel = append(kernel, f)
+			} else {
+				other = append(other, f)
+			}
+		})
+	}
+
+	sections := k.configSections()
+
+	if len(kernel) > 0 {
+		k.writeHelpGroup(w, "Kernel", kernel, nil)
+	}
+
+	k.services.Iterator().ForEach(func(s Service) {
+		title := displayName(s)
+		if ds, ok := s.(DescribedService); ok {
+			title = title + ": " + ds.Describe()
+		} else if len(flags[s]) == 0 && len(sections[s]) == 0 {
+			return
+		}
+		k.writeHelpGroup(w, title, flags[s], sections[s])
+	})
+
+	if len(other) > 0 {
+		k.writeHelpGroup(w, "Other", other, nil)
+	}
+}
+
+func (k *Kernel) writeHelpGroup(w io.Writer, title string, flags []*flag.Flag, sections []string) {
+	fmt.Fprintf(w, "\n%s\n", title)
+
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	for _, f := range flags {
+		k.writeFlagHelp(w, f)
+	}
+
+	dc := k.dynamicConfig()
+	for _, section := range sections {
+		dc.writeSectionHelp(w, section)
+	}
+}
+
+// writeFlagHelp writes the help for a flag in the same format as flag.PrintDefaults
+func (k *Kernel) writeFlagHelp(w io.Writer, f *flag.Flag) {
+	name, usage := flag.UnquoteUsage(f)
+	if name != "" {
+		fmt.Fprintf(w, "  -%s %s\n", f.Name, name)
+	} else {
+		fmt.Fprintf(w, "  -%s\n", f.Name)
+	}
+
+	usage = strings.ReplaceAll(usage, "\n", "\n    \t")
+	switch f.DefValue {
+	case "", "0", "false", "0s", "[]":
+	default:
+		if g, ok := f.Value.(flag.Getter); ok && isString(g.Get()) {
+			usage += fmt.Sprintf(" (default %q)", f.DefValue)
+		} else {
+			usage += fmt.Sprintf(" (default %v)", f.DefValue)
+		}
+	}
+
+	// Where else the flag can be set from
+	var from []string
+	for _, env := range k.flagEnvNames(f.Name) {
+		from = append(from, "$"+env)
+	}
+	if c := k.flagBindings[f.Name].config; c != "" {
+		from = append(from, "config "+c)
+	}
+
+	fmt.Fprintf(w, "    \t%s [%s]\n", usage, strings.Join(from, ", "))
+}
+
+func isString(v interface{}) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+// dynamicConfig returns the deployed dynamicConfig, nil if there is none
+func (k *Kernel) dynamicConfig() *dynamicConfig {
+	// Lazy injection can deploy services whilst the kernel is running
+	k.indexMutex.RLock()
+	defer k.indexMutex.RUnlock()
+
+	if sv, exists := k.index[getServiceName(reflect.TypeOf(dynamicConfig{}))]; exists {
+		return sv.(*dynamicConfig)
+	}
+	return nil
+}
+
+// configSections returns the names of the config sections injected into each service
+func (k *Kernel) configSections() map[Service][]string {
+	sections := make(map[Service][]string)
+	dc := k.dynamicConfig()
+	if dc == nil {
+		return sections
+	}
+
+	var names []string
+	for name := range dc.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		seen := make(map[Service]bool)
+		for _, ip := range dc.entries[name].injectionPoints {
+			if owner := ip.Owner(); !seen[owner] {
+				seen[owner] = true
+				sections[owner] = append(sections[owner], name)
+			}
+		}
+	}
+	return sections
+}
+
+// writeSectionHelp writes the help for a config section, listing each field and its environment variable
+func (dc *dynamicConfig) writeSectionHelp(w io.Writer, name string) {
+	t := reflect.TypeOf(dc.entries[name].config).Elem()
+	fmt.Fprintf(w, "  config %s %s\n", name, t)
+
+	prefix := envName(dc.kernel.envPrefix + "_" + name)
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	var write func(t reflect.Type, path, prefix string)
+	write = func(t reflect.Type, path, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			field, ok := yamlFieldName(sf)
+			if !ok || !sf.IsExported() {
+				continue
+			}
+
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			env := prefix + "_" + envName(field)
+			// Nested structs list their own fields, unless they are parsed from text like time.Time
+			if ft.Kind() == reflect.Struct && !reflect.PointerTo(ft).Implements(textUnmarshalerType) {
+				write(ft, path+field+".", env)
+				continue
+			}
+
+			desc := ""
+			if d, exists := sf.Tag.Lookup("default"); exists {
+				desc = fmt.Sprintf(" (default %v)", d)
+			}
+			fmt.Fprintf(w, "    \t%s%s %s%s [$%s]\n", path, field, sf.Type, desc, env)
+		}
+	}
+	write(t, "", prefix)
+}
+
+// displayName returns the name of a service to show to the user
+func displayName(s Service) string {
+	if ns, ok := s.(NamedService); ok {
+		return ns.Name()
+	}
+	return strings.TrimPrefix(reflect.TypeOf(s).String(), "*")
+}
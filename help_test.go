@@ -0,0 +1,103 @@
+package kernel
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+type testHelpService struct {
+	port   *int        `kernel:"flag,port,Port to listen on,8080,env=PORT"`
+	limits *testConfig `kernel:"config,limits"`
+	debug  *bool
+}
+
+func (s *testHelpService) Init(k *Kernel) error {
+	s.debug = k.FlagSet().Bool("debug", false, "Enable debugging")
+	return nil
+}
+
+func (s *testHelpService) Describe() string {
+	return "Serves requests"
+}
+
+func TestKernel_WriteHelp(t *testing.T) {
+	k := NewKernel()
+	if _, err := k.AddService(&testHelpService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	k.WriteHelp(&buf)
+	help := buf.String()
+
+	for _, expected := range []string{
+		"\nKernel\n  -kernel-graph string\n",
+		"\nkernel.testHelpService: Serves requests\n",
+		"  -debug\n    \tEnable debugging [$FLAG_DEBUG]\n",
+		"  -port int\n    \tPort to listen on (default 8080) [$PORT, $FLAG_PORT]\n",
+		"  config limits kernel.testConfig\n    \tlevel string [$APP_LIMITS_LEVEL]\n",
+		"\nkernel.dynamicConfig: Configuration files\n  -config string\n",
+	} {
+		if !strings.Contains(help, expected) {
+			t.Errorf("expected %q in help:\n%s", expected, help)
+		}
+	}
+
+	// The help groups the flags so must not duplicate them
+	if strings.Count(help, "-port") != 1 {
+		t.Errorf("expected -port once in help:\n%s", help)
+	}
+}
+
+func TestKernel_Usage(t *testing.T) {
+	k := NewKernel()
+	k.SetArgs("-h")
+	if _, err := k.AddService(&testHelpService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	k.FlagSet().SetOutput(&buf)
+
+	if err := k.Run(); err != flag.ErrHelp {
+		t.Fatalf("expected ErrHelp, got %v", err)
+	}
+
+	if !strings.Contains(buf.String(), "Serves requests") {
+		t.Errorf("expected generated help, got:\n%s", buf.String())
+	}
+}
+
+// TestKernel_CommandLineUsage ensures the singleton only uses the generated help when the application
+// has not set its own flag.Usage
+func TestKernel_CommandLineUsage(t *testing.T) {
+	var buf bytes.Buffer
+	flag.CommandLine.SetOutput(&buf)
+	defer flag.CommandLine.SetOutput(nil)
+
+	flag.CommandLine.Usage()
+	if !strings.Contains(buf.String(), "-"+shutdownTimeoutFlag) {
+		t.Errorf("expected generated help, got:\n%s", buf.String())
+	}
+
+	saved := flag.Usage
+	defer func() {
+		flag.Usage = saved
+	}()
+
+	called := false
+	flag.Usage = func() {
+		called = true
+	}
+
+	buf.Reset()
+	flag.CommandLine.Usage()
+	if !called {
+		t.Error("application flag.Usage not called")
+	}
+	if buf.Len() > 0 {
+		t.Errorf("expected no generated help, got:\n%s", buf.String())
+	}
+}
@@ -14,8 +14,9 @@ func (k *Kernel) inject(v interface{}) error {
 
 	tv := reflect.ValueOf(v)
 
+	// Only a pointer to a struct can have injection points
 	t := tv.Type()
-	if t == nil {
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
 		return nil
 	}
 
@@ -68,8 +69,25 @@ func (k *Kernel) injectField(tag string, ip *injection.Point) error {
 		return ip.Errorf("unsupported kernel tag %q", tags[0])
 	}
 
+	// Only inject supports slices & maps of services and lazy or provider funcs
+	switch kind := ip.StructField().Type.Kind(); kind {
+	case reflect.Slice, reflect.Map, reflect.Func:
+		if tags[0] != "inject" {
+			return ip.Errorf("kernel:%q does not support a %s", tags[0], kind)
+		}
+	}
+
+	// Only config can be injected into a value, and only if it's a struct
+	if ip.IsValue() && (tags[0] != "config" || ip.Type().Kind() != reflect.Struct) {
+		return ip.Errorf("must be a pointer")
+	}
+
 	if injector != nil {
-		if err := injector(tags[1:], ip); err != nil {
+		// Record the field so any dependency it creates is recorded against it
+		k.via = &dependencyRef{field: ip.StructField().Name, tag: tag}
+		err := injector(tags[1:], ip)
+		k.via = nil
+		if err != nil {
 			return err
 		}
 	}
@@ -77,36 +95,219 @@ func (k *Kernel) injectField(tag string, ip *injection.Point) error {
 	return nil
 }
 
-// injectService injects a dependency into the service structure
-func (k *Kernel) injectService(_ []string, ip *injection.Point) error {
+// injectOptions are the options supported by the inject tag
+type injectOptions struct {
+	name     string // name=n  inject the API registered with RegisterNamedAPI under the name n
+	all      bool   // all     inject every implementation of an API into a slice or map[string] field
+	optional bool   // optional leave the field nil if the service has not been deployed or registered
+	lazy     bool   // lazy    inject a func which resolves the service when first called
+	scope    string // scope=s inject an instance from the Scope named s
+}
+
+func parseInjectOptions(tags []string, ip *injection.Point) (injectOptions, error) {
+	var opts injectOptions
+	for _, tag := range tags {
+		switch {
+		case tag == "all":
+			opts.all = true
+		case tag == "optional":
+			opts.optional = true
+		case tag == "lazy":
+			opts.lazy = true
+		case strings.HasPrefix(tag, "name="):
+			opts.name = strings.TrimPrefix(tag, "name=")
+		case strings.HasPrefix(tag, "scope=") && tag != "scope=":
+			opts.scope = strings.TrimPrefix(tag, "scope=")
+		default:
+			return opts, ip.Errorf("unsupported inject option %q", tag)
+		}
+	}
+	return opts, nil
+}
+
+// injectService injects a dependency into the service structure.
+//
+// Supported options are:
+//
+//	name=n   inject the API registered with RegisterNamedAPI under the name n
+//	all      inject every implementation of an API into a slice or map[string] field
+//	optional leave the field nil if the service has not been deployed or registered
+//	lazy     inject a func() T or func() (T, error) which resolves the service when first called
+//	scope=s  inject an instance from the Scope named s, only when injected with Scope.Inject
+func (k *Kernel) injectService(tags []string, ip *injection.Point) error {
+	opts, err := parseInjectOptions(tags, ip)
+	if err != nil {
+		return err
+	}
+
+	switch kind := ip.StructField().Type.Kind(); {
+	case opts.scope != "":
+		return ip.Errorf("scope %s can only be injected with Scope.Inject", opts.scope)
+	case opts.all && (opts.name != "" || opts.lazy):
+		return ip.Errorf("cannot use all with name or lazy")
+	case opts.all:
+		return k.injectAll(ip)
+	case kind == reflect.Slice || kind == reflect.Map:
+		return ip.Errorf("slice or map requires the all option")
+	case opts.lazy:
+		return k.injectLazy(opts, ip)
+	case kind == reflect.Func:
+		return ip.Errorf("func requires the lazy option")
+	}
+
+	resolvedService, err := k.resolveService(opts, ip)
+	if err == nil && resolvedService != nil {
+		ip.Set(resolvedService)
+	}
+	return err
+}
+
+// resolveService returns the service for an injection point, deploying it if required.
+// If optional and the service has not been deployed then this returns nil.
+func (k *Kernel) resolveService(opts injectOptions, ip *injection.Point) (Service, error) {
+	return k.resolveType(ip.Type(), opts, ip.Errorf)
+}
+
+// resolveType returns the service for a type, deploying it if required.
+// For a pointer, t is the type pointed to. errorf is used to create any errors specific to the
+// injection point.
+func (k *Kernel) resolveType(t reflect.Type, opts injectOptions, errorf func(string, ...interface{}) error) (Service, error) {
+	if opts.name != "" {
+		n := getQualifiedServiceName(t, opts.name)
+		if resolvedService, exists := k.index[n]; exists {
+			k.recordDependency(n)
+			return resolvedService, nil
+		}
+		if opts.optional {
+			return nil, nil
+		}
+		return nil, errorf("no %s registered with name %q", t, opts.name)
+	}
 
 	// See if we already have the service deployed.
 	// At this point it could be either a Service or an API
-	t := ip.Type()
 	n := getServiceName(t)
 	if resolvedService, exists := k.index[n]; exists {
-		ip.Set(resolvedService)
-		return nil
+		k.recordDependency(n)
+		return resolvedService, nil
+	}
+
+	// Create it from a provider if one has been registered
+	if provider, exists := k.providers[n]; exists {
+		return k.provide(n, provider)
+	}
+
+	if opts.optional {
+		// A NamedService is not indexed by its type so look for a deployed instance
+		pt := reflect.PointerTo(t)
+		var found Service
+		k.services.ForEach(func(s Service) {
+			if found == nil && reflect.TypeOf(s) == pt {
+				found = s
+			}
+		})
+		if found != nil {
+			k.recordDependency(serviceName(found))
+		}
+		return found, nil
 	}
 
-	inst := ip.New()
+	inst := reflect.New(t).Interface()
 	if sInst, ok := inst.(Service); ok {
 		// Add the service in the traditional way, returning us the deployed instance
-		resolvedService, err := k.AddService(sInst)
-		if err != nil {
-			return err
+		return k.deploy(sInst)
+	}
+
+	return nil, errorf("not a Service")
+}
+
+// pendingAll is a field injected with kernel:"inject,all" which has yet to be filled
+type pendingAll struct {
+	ip   *injection.Point // The field
+	from string           // Name of the service the field belongs to
+	via  *dependencyRef   // The field & tag for the dependency graph
+}
+
+// injectAll injects every implementation of an API into either a slice or a map keyed by the name it was
+// registered under, "" for one registered with RegisterAPI.
+//
+// As implementations can be registered after the field is injected, e.g. by a plugin, the field is not filled
+// until the kernel is read only, once every service has been deployed.
+func (k *Kernel) injectAll(ip *injection.Point) error {
+	ft := ip.StructField().Type
+	if ip.Type().Kind() != reflect.Interface {
+		return ip.Errorf("all requires an interface")
+	}
+
+	switch ft.Kind() {
+	case reflect.Slice:
+	case reflect.Map:
+		if ft.Key().Kind() != reflect.String {
+			return ip.Errorf("all requires a map with string keys")
 		}
+	default:
+		return ip.Errorf("all requires a slice or map")
+	}
 
-		ip.Set(resolvedService)
-	} else {
-		return ip.Errorf("not a Service")
+	p := pendingAll{ip: ip, via: k.via}
+	if len(k.deploying) > 0 {
+		p.from = k.deploying[len(k.deploying)-1].To
 	}
 
+	// Once read only no more implementations can be registered, e.g. when deployed lazily
+	if k.readOnly {
+		k.fillAll(p)
+	} else {
+		k.pendingAll = append(k.pendingAll, p)
+	}
 	return nil
 }
 
+// fillPendingAll fills every field injected with kernel:"inject,all" whilst deploying.
+// This is called once the kernel is read only.
+func (k *Kernel) fillPendingAll() {
+	for _, p := range k.pendingAll {
+		k.fillAll(p)
+	}
+	k.pendingAll = nil
+}
+
+// fillAll sets a field to every implementation of its API, recording each as a dependency
+func (k *Kernel) fillAll(p pendingAll) {
+	ft := p.ip.StructField().Type
+	implementations := k.apis[getServiceName(p.ip.Type())]
+
+	var v reflect.Value
+	if ft.Kind() == reflect.Slice {
+		v = reflect.MakeSlice(ft, 0, len(implementations))
+	} else {
+		v = reflect.MakeMapWithSize(ft, len(implementations))
+	}
+
+	for _, impl := range implementations {
+		// Record each one as a dependency against this field
+		if p.from != "" {
+			d := Dependency{From: p.from, To: impl.key}
+			if p.via != nil {
+				d.Field = p.via.field
+				d.Tag = p.via.tag
+			}
+			k.graph = append(k.graph, d)
+		}
+
+		sv := reflect.ValueOf(impl.service).Convert(p.ip.Type())
+		if ft.Kind() == reflect.Slice {
+			v = reflect.Append(v, sv)
+		} else {
+			v.SetMapIndex(reflect.ValueOf(impl.name).Convert(ft.Key()), sv)
+		}
+	}
+
+	p.ip.Set(v.Interface())
+}
+
 func (k *Kernel) injectWorker(_ []string, ip *injection.Point) error {
-	resolvedService, err := k.AddService(&Worker{})
+	resolvedService, err := k.deploy(&Worker{})
 	if err != nil {
 		return err
 	}
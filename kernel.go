@@ -6,6 +6,10 @@
 // Start phase then any Error will cause the Stop phase to be invoked to allow
 // any Started service to cleanup.
 //
+// The kernel has a root context.Context which is passed to services implementing
+// ContextStartableService or ContextRunnableService. It's cancelled on SIGINT/SIGTERM
+// or when a service fails so that long-running services can exit cooperatively.
+//
 // For most simple applications you can simply use kernel.Launch( s ) where s is
 // an uninitiated service and it will create a Kernel add that service and run it.
 //
@@ -21,6 +25,7 @@
 package kernel
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -29,7 +34,10 @@ import (
 	"os"
 	"os/signal"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 // Service to be deployed within the Kernel
@@ -49,6 +57,13 @@ type InitialisableService interface {
 	Init(*Kernel) error
 }
 
+// BeforeParseService is a Service which is called once every service has been deployed but before the command line
+// is parsed, e.g. to deploy more services which declare flags of their own. Kernel.PeekFlag returns the value of a flag
+// at this point.
+type BeforeParseService interface {
+	BeforeParse(*Kernel) error
+}
+
 // PostInitialisableService a Service that expects to be called in the PostInit lifecycle phase
 type PostInitialisableService interface {
 	// PostInit initialises a Service when it's added to the Kernel
@@ -61,94 +76,419 @@ type StartableService interface {
 	Start() error
 }
 
+// ContextStartableService is an alternative to StartableService where the service receives the
+// kernel's root context. The context is cancelled when the kernel receives a signal or a service fails,
+// so it can be used to stop any background goroutines the service starts.
+type ContextStartableService interface {
+	// StartContext called when the Kernel starts but before services Run
+	StartContext(ctx context.Context) error
+}
+
 // StoppableService a Service that expects to be called when the kernel shutsdown if it's in the
 // Start or Run lifecycle phases
 type StoppableService interface {
 	Stop()
 }
 
+// GracefulStoppableService is an alternative to StoppableService where the service is given a
+// context which will be cancelled when the shutdown deadline has been reached.
+// Any error returned is reported when the kernel exits.
+type GracefulStoppableService interface {
+	Stop(ctx context.Context) error
+}
+
+// StopTimeoutService is an optional interface a StoppableService or GracefulStoppableService can
+// implement to limit how long the kernel will wait for it to stop.
+// This cannot extend the deadline set by the -shutdown-timeout flag, which is shared by every service,
+// only shorten it. Zero uses that deadline.
+type StopTimeoutService interface {
+	StopTimeout() time.Duration
+}
+
 // RunnableService a Service that is expected to run in the Run lifecycle phase
 type RunnableService interface {
 	// Run executes the service
 	Run() error
 }
 
+// ContextRunnableService is an alternative to RunnableService where the service receives the
+// kernel's root context. The service should return once the context has been cancelled.
+type ContextRunnableService interface {
+	// RunContext executes the service until it completes or ctx is cancelled
+	RunContext(ctx context.Context) error
+}
+
+// ConcurrentRunnableService is an optional interface a RunnableService or ContextRunnableService can
+// implement to run concurrently with other services in the Run lifecycle phase.
+//
+// Concurrent services are started in their own goroutine in the order they were deployed.
+// The Run phase completes once they have all returned. The first one to fail cancels the context
+// passed to the others and begins the Stop phase, so those blocked in Run() until Stop() is called also return.
+type ConcurrentRunnableService interface {
+	// RunConcurrently returns true if the service should run concurrently
+	RunConcurrently() bool
+}
+
 // Kernel is the core container for deployed services
 type Kernel struct {
-	services     util.List[Service] // The deployed services
-	stopList     util.List[Service] // The services that are running & need to be shut down
-	dependencies util.Set[Service]  // Used to prevent circular dependencies
-	index        map[string]Service // Map of services by name
-	readOnly     bool               // mark the kernel as read only
+	services     util.List[Service]             // The deployed services
+	stopList     util.List[Service]             // The services that are running & need to be shut down
+	dependencies util.Set[Service]              // Used to prevent circular dependencies
+	index        map[string]Service             // Map of services by name
+	apis         map[string][]apiImplementation // Implementations of each API in registration order
+	providers    map[string]reflect.Value       // Provider functions by the name of the type they provide
+	deploying    []Dependency                   // Stack of services currently being deployed
+	graph        []Dependency                   // The dependencies between services
+	via          *dependencyRef                 // The field currently being injected
+	pendingAll   []pendingAll                   // Fields injected with all which are filled once read only
+	flags        *flag.FlagSet                  // The FlagSet used for command line flags
+	args         []string                       // The arguments to parse with flags
+	readOnly     bool                           // mark the kernel as read only
+	concurrent   bool                           // true to run all services concurrently
+	envPrefix    string                         // Prefix of environment variables overriding config
+	flagPrefix   string                         // Prefix of environment variables setting flags
+	flagBindings map[string]flagBinding         // Environment and config fallbacks of flags
+	commands     map[string]*command            // Subcommands by name
+	command      *selectedCommand               // The selected subcommand, nil if none
+	flagOwners   map[string]Service             // The service which declared each flag, nil for the kernel
+	strictConfig bool                           // true if unknown config sections and keys are errors
+	mutex        sync.Mutex                     // Guards stopList, ctx & cancel
+	lazyMutex    sync.Mutex                     // Guards deploying services from lazy injection, graph, lazyStarts, readOnly & stopping
+	lazyStarts   map[Service]*lazyStart         // Services deployed lazily which are still being started
+	lazyDeployer atomic.Uint64                  // Id of the goroutine deploying lazily whilst holding lazyMutex, 0 if none
+	indexMutex   sync.RWMutex                   // Guards index & services as they can be read whilst deploying lazily
+	configMutex  sync.RWMutex                   // Guards injected config during a reload
+	listeners    []LifecycleListener            // Listeners notified of lifecycle events
+	stopping     bool                           // true once the Stop phase has begun
+	phase        Phase                          // The current lifecycle phase
+	healthChecks []HealthCheckService           // Services which can report their health
+	ctx          context.Context                // The root context once the kernel has started
+	cancel       context.CancelCauseFunc        // Cancels the root context
+	crashes      []Crash                        // Log of supervised services which have failed
+}
+
+// NewKernel creates a new Kernel independent of the one used by Launch() & Register().
+//
+// The new Kernel has its own flag.FlagSet so any flags declared with the kernel:"flag" tag
+// do not clash with those in another Kernel. By default no command line arguments are parsed,
+// use SetArgs() to provide them.
+func NewKernel() *Kernel {
+	return newKernel(flag.NewFlagSet(os.Args[0], flag.ContinueOnError), nil)
+}
+
+func newKernel(flags *flag.FlagSet, args []string) *Kernel {
+	declareFlag(flags, shutdownTimeoutFlag, defaultShutdownTimeout, "Time to allow the services to stop on shutdown")
+	declareFlag(flags, graphFlag, "", "Print the service dependency graph as dot|json then exit")
+	k := &Kernel{
+		dependencies: util.NewSyncSet[Service](),
+		services:     util.NewList[Service](),
+		stopList:     util.NewList[Service](),
+		index:        make(map[string]Service),
+		apis:         make(map[string][]apiImplementation),
+		providers:    make(map[string]reflect.Value),
+		flags:        flags,
+		args:         args,
+		envPrefix:    defaultEnvPrefix,
+		flagPrefix:   defaultFlagEnvPrefix,
+		flagBindings: make(map[string]flagBinding),
+		commands:     make(map[string]*command),
+		flagOwners:   make(map[string]Service),
+		lazyStarts:   make(map[Service]*lazyStart),
+	}
+
+	// The kernel's own flags have no service as their owner
+	for _, name := range kernelFlags {
+		k.flagOwners[name] = nil
+	}
+	flags.Usage = k.usage
+
+	return k
+}
+
+// FlagSet returns the flag.FlagSet this Kernel uses for command line flags.
+// Once a command has been selected this is the command's FlagSet.
+func (k *Kernel) FlagSet() *flag.FlagSet {
+	if k.command != nil {
+		return k.command.flags
+	}
+	return k.flags
+}
+
+// SetArgs sets the command line arguments the Kernel will parse when Run() is called.
+func (k *Kernel) SetArgs(args ...string) {
+	k.args = args
+}
+
+// SetConcurrentRun sets whether all services run concurrently in the Run lifecycle phase.
+// The default is false where only services implementing ConcurrentRunnableService run concurrently.
+// A service implementing ConcurrentRunnableService always takes precedence over this setting.
+func (k *Kernel) SetConcurrentRun(concurrent bool) {
+	k.concurrent = concurrent
 }
 
 // Launch is a convenience method to launch a single service.
 // This does the boilerplate work and requires the single service adds any
 // injectionPoints within it's Init() method, if any
+//
+// On SIGINT or SIGTERM the kernel's root context is cancelled so that services can exit cooperatively,
+// and the started services are stopped. If the kernel has not returned by the shutdown deadline,
+// measured from the signal, then the process exits with status 1.
 func Launch(services ...Service) error {
+	k := instance
+
+	// When kernel exits, then reset it, even if deployment fails so it's left in a clean state
+	defer resetKernel()
 
 	// Add the supplied services in sequence. This creates the dependency graph
-	if err := instance.DependsOn(services...); err != nil {
+	if err := k.DependsOn(services...); err != nil {
 		return err
 	}
 
-	if instance.services.IsEmpty() {
-		return errors.New("kernel is empty")
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// From this point nothing else can be added to the Kernel
-	instance.readOnly = true
-	// When kernel exits, then reset it
-	defer resetKernel()
-
-	flag.Parse()
+	// Closed once the kernel has returned
+	done := make(chan struct{})
 
-	// PostInit services
-	if err := instance.postInit(); err != nil {
-		return err
-	}
+	// Any errors from stopping the services after a signal
+	stopped := make(chan error, 1)
 
 	// Listen to signals & close the db before exiting
 	// SIGINT for ^C, SIGTERM for docker stopping the container
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
 	go func() {
-		sig := <-signals
-		log.Println("Signal", sig)
+		select {
+		case <-done:
+			stopped <- nil
+			return
+		case sig := <-signals:
+			log.Println("Signal", sig)
+			cancel()
+		}
 
-		instance.stop()
+		// From now the kernel has until the shutdown deadline to return, otherwise it's forced
+		forced := time.NewTimer(k.shutdownTimeout())
+		defer forced.Stop()
+
+		// Stop the started services now, so any blocked in Run() until Stop() is called return.
+		// The root context has already been cancelled as it's derived from ctx
+		stopErr := make(chan error, 1)
+		go func() {
+			stopErr <- k.stop()
+		}()
+
+		// Wait for both the services to stop and the kernel to return
+		exited := done
+		for pending := 2; pending > 0; pending-- {
+			select {
+			case err := <-stopErr:
+				stopped <- err
+			case <-exited:
+				exited = nil
+			case <-forced.C:
+				// This is never a clean shutdown, whatever the services returned
+				log.Println("Kernel did not exit in time, forcing shutdown")
+				os.Exit(1)
+			}
+		}
+	}()
 
-		log.Println("Application terminated")
+	err := k.RunContext(ctx)
+	close(done)
 
-		os.Exit(0)
-	}()
+	// Wait for the services to stop if a signal was received
+	return errors.Join(err, <-stopped)
+}
+
+// Run runs the kernel through the PostInit, Start & Run lifecycle phases.
+// Once the Start phase has begun then any started services will be stopped
+// when this returns, with any errors from stopping them included in the returned error.
+//
+// This is the same as RunContext(context.Background())
+func (k *Kernel) Run() error {
+	return k.RunContext(context.Background())
+}
+
+// RunContext is the same as Run but the kernel's root context is derived from ctx.
+//
+// The root context is passed to any ContextStartableService or ContextRunnableService.
+// It is cancelled when ctx is cancelled, when a service fails in the Start or Run phases,
+// or once the Run phase has completed.
+//
+// If ctx is cancelled during the Run phase then no further services are run and,
+// unless a service fails, nil is returned.
+func (k *Kernel) RunContext(ctx context.Context) (err error) {
+	if err := k.prepare(); err != nil {
+		return err
+	}
+
+	// If requested, print the dependency graph instead of running
+	if format := k.graphFormat(); format != "" {
+		return k.Graph().Write(os.Stdout, format)
+	}
 
-	// At this point stop all started services on failure or exit
-	defer instance.stop()
+	if err := k.runPostInit(); err != nil {
+		return err
+	}
+
+	// If requested, print the config instead of starting
+	if k.configDump() {
+		return k.DumpConfig(os.Stdout)
+	}
+
+	// At this point stop all started services on failure or exit.
+	// Shutdown cancels the root context first so any background goroutines exit.
+	defer func() {
+		if stopErr := k.Shutdown(); stopErr != nil {
+			err = errors.Join(err, stopErr)
+		}
+	}()
 
 	// Start services
-	if err := instance.start(); err != nil {
+	if err := k.Start(ctx); err != nil {
 		return err
 	}
 
 	// Run services
-	return instance.run()
+	k.phaseChanged(PhaseRun)
+	rootCtx, _ := k.rootContext()
+	if err := k.run(rootCtx); err != nil {
+		return err
+	}
+
+	// Return any failure passed to Fail()
+	return k.failure()
+}
+
+// prepare calls any BeforeParseService, makes the kernel read only then parses the command line
+func (k *Kernel) prepare() error {
+	// These are called first as they can deploy services which declare flags
+	if !k.flags.Parsed() {
+		if err := k.beforeParse(); err != nil {
+			return err
+		}
+	}
+
+	if k.services.IsEmpty() && len(k.commands) == 0 {
+		return errors.New("kernel is empty")
+	}
+
+	if !k.flags.Parsed() {
+		if err := k.flags.Parse(k.args); err != nil {
+			return err
+		}
+	}
+
+	if err := k.selectCommand(); err != nil {
+		return err
+	}
+
+	// From this point nothing else can be added to the Kernel.
+	// This is never cleared, services deployed lazily once running do not check it.
+	k.lazyMutex.Lock()
+	k.readOnly = true
+	k.lazyMutex.Unlock()
+
+	// Every implementation of an API has now been registered
+	k.fillPendingAll()
+
+	return k.applyFlagFallbacks()
+}
+
+// PostInit parses the command line then runs the PostInit lifecycle phase.
+//
+// Run and RunContext do this for you. Along with Start and Shutdown, this allows the lifecycle
+// to be run one phase at a time, e.g. within tests.
+func (k *Kernel) PostInit() error {
+	if err := k.prepare(); err != nil {
+		return err
+	}
+	return k.runPostInit()
+}
+
+func (k *Kernel) runPostInit() error {
+	k.collectListeners()
+	k.collectHealthChecks()
+
+	k.phaseChanged(PhasePostInit)
+	return k.postInit()
+}
+
+// Start runs the Start lifecycle phase, with the kernel's root context derived from ctx.
+// PostInit must have been called first. Any config files are loaded and validated before any service is started.
+//
+// Run and RunContext do this for you. Shutdown must be called to stop any started services.
+func (k *Kernel) Start(ctx context.Context) error {
+	// Load and validate the config before any service has started
+	if dc := k.dynamicConfig(); dc != nil {
+		if err := dc.loadInitial(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	// Services deployed lazily once the root context is set are started by resolveLazy,
+	// those deployed before then are in the snapshot started here
+	k.lazyMutex.Lock()
+	k.mutex.Lock()
+	k.ctx = ctx
+	k.cancel = cancel
+	stopping := k.stopping
+	k.mutex.Unlock()
+	services := k.services.Iterator()
+	k.lazyMutex.Unlock()
+
+	// Shutdown has already been called, e.g. on a signal
+	if stopping {
+		cancel(nil)
+	}
+
+	k.phaseChanged(PhaseStart)
+	return k.start(ctx, services)
+}
+
+// Shutdown cancels the root context then stops all services that have been started,
+// in the reverse order they were started.
+// It is safe to call this more than once, each service will be stopped only once.
+//
+// The services share one deadline, set with the -shutdown-timeout flag, to stop.
+// A service which does not stop by then is logged and skipped.
+// The returned error contains every error returned by a service whilst stopping, or nil if
+// shutdown was clean.
+func (k *Kernel) Shutdown() error {
+	if _, cancel := k.rootContext(); cancel != nil {
+		cancel(nil)
+	}
+	return k.stop()
+}
+
+// rootContext returns the root context and its cancel func, both nil if the kernel has not started.
+// They are set by Start, which can happen whilst another goroutine calls Shutdown or Fail.
+func (k *Kernel) rootContext() (context.Context, context.CancelCauseFunc) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.ctx, k.cancel
 }
 
 // DependsOn just adds injectionPoints on other services, it does not return the resolved Service's.
-// This is short of _,err:=instance.AddService() for each dependency.
+// This is short of _,err:=k.AddService() for each dependency.
 func (k *Kernel) DependsOn(services ...Service) error {
 	// Add the supplied services in sequence. This creates the dependency graph
 	for _, s := range services {
-		if _, err := instance.AddService(s); err != nil {
+		if _, err := k.AddService(s); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func assertInstanceAmendable() error {
-	if instance.readOnly {
+// assertAmendable returns an error once the kernel is read only.
+// readOnly is set once, before any service has started, so it can be read without lazyMutex.
+func (k *Kernel) assertAmendable() error {
+	if k.readOnly {
 		return errors.New("kernel is read only")
 	}
 	return nil
@@ -160,30 +500,66 @@ func getServiceName(t reflect.Type) string {
 
 // AddService adds a service to the kernel
 func (k *Kernel) AddService(s Service) (Service, error) {
-	// Generate the service name either via NamedService or reflection
-	var name string
-	if ns, ok := s.(NamedService); ok {
-		name = ns.Name()
-	} else {
-		name = getServiceName(reflect.ValueOf(s).Elem().Type())
+	if err := k.assertAmendable(); err != nil {
+		return nil, err
 	}
+	return k.deploy(s)
+}
 
-	return k.addService(name, s, false)
+// deploy adds a service to the kernel without checking if the kernel is read only.
+// This is used when resolving dependencies, which can happen lazily once the kernel is running.
+func (k *Kernel) deploy(s Service) (Service, error) {
+	return k.addService(serviceName(s), s, false)
 }
 
-func (k *Kernel) addService(name string, s Service, api bool) (Service, error) {
-	if err := assertInstanceAmendable(); err != nil {
-		return nil, err
+// Override adds an already initialised service to the kernel, so that it is injected wherever
+// it is required instead of a new instance being deployed, e.g. a mock within a test.
+//
+// Its fields are not injected and Init is not called, but it takes part in the rest of the lifecycle.
+func (k *Kernel) Override(s Service) error {
+	if err := k.assertAmendable(); err != nil {
+		return err
+	}
+
+	return k.override(serviceName(s), s)
+}
+
+// override adds an already initialised service under a name without injecting it or calling Init
+func (k *Kernel) override(name string, s Service) error {
+	if _, exists := k.index[name]; exists {
+		return fmt.Errorf("service %s already deployed", name)
+	}
+
+	k.addDeployed(name, s)
+	return nil
+}
+
+// addDeployed adds a service to the end of the startup list once it has been deployed
+func (k *Kernel) addDeployed(name string, s Service) {
+	k.indexMutex.Lock()
+	defer k.indexMutex.Unlock()
+	k.services.Add(s)
+	k.index[name] = s
+}
+
+// serviceName generates the service name either via NamedService or reflection
+func serviceName(s Service) string {
+	if ns, ok := s.(NamedService); ok {
+		return ns.Name()
 	}
+	return getServiceName(reflect.ValueOf(s).Elem().Type())
+}
+
+func (k *Kernel) addService(name string, s Service, api bool) (Service, error) {
+	dependency := k.recordDependency(name)
 
 	// Prevent circular injectionPoints
-	if instance.dependencies.Contains(name) {
-		//if _, exists := instance.injectionPoints[s.Name()]; exists {
-		return nil, fmt.Errorf("Circular dependency %s", name)
+	if k.dependencies.Contains(name) {
+		return nil, k.cycleError(dependency)
 	}
 
 	// Check we don't already have it
-	if service, exists := instance.index[name]; exists {
+	if service, exists := k.index[name]; exists {
 		return service, nil
 	}
 
@@ -194,69 +570,215 @@ func (k *Kernel) addService(name string, s Service, api bool) (Service, error) {
 
 	// This will prevent circular injectionPoints by using this map
 	// to keep track of what's currently being deployed
-	instance.dependencies.Add(name)
-	defer instance.dependencies.Remove(name)
+	k.dependencies.Add(name)
+	defer k.dependencies.Remove(name)
+
+	// Keep track of who is deploying whom for the dependency graph
+	k.deploying = append(k.deploying, dependency)
+	defer func() {
+		k.deploying = k.deploying[:len(k.deploying)-1]
+	}()
+
+	// Flags declared from here on belong to this service
+	flags := k.flagNames()
+
+	k.initPhase()
 
 	// inject injectionPoints using struct field tags
-	if err := instance.inject(s); err != nil {
+	if err := k.inject(s); err != nil {
 		return nil, err
 	}
 
 	// Init the service, it can add injectionPoints here
 	if is, ok := s.(InitialisableService); ok {
-		if err := is.Init(k); err != nil {
+		if err := k.observe(PhaseInit, s, func() error {
+			return is.Init(k)
+		}); err != nil {
 			return nil, err
 		}
 	}
 
+	k.recordFlagOwners(s, flags)
+
 	// Finally, add the service to the end of the startup list
-	instance.services.Add(s)
-	instance.index[name] = s
+	k.addDeployed(name, s)
 
 	return s, nil
 }
 
-func (k *Kernel) postInit() error {
-	return instance.services.ForEachFailFast(func(s Service) error {
-		if pi, ok := s.(PostInitialisableService); ok {
-			if err := pi.PostInit(); err != nil {
-				return err
-			}
+func (k *Kernel) beforeParse() error {
+	return k.services.Iterator().ForEachFailFast(func(s Service) error {
+		if bp, ok := s.(BeforeParseService); ok {
+			return bp.BeforeParse(k)
 		}
 		return nil
 	})
 }
 
-func (k *Kernel) start() error {
-	return instance.services.ForEachFailFast(func(s Service) error {
-		// Start the service
-		if ss, ok := s.(StartableService); ok {
-			if err := (ss).Start(); err != nil {
-				return err
+func (k *Kernel) postInit() error {
+	return k.services.ForEachFailFast(k.postInitService)
+}
+
+func (k *Kernel) postInitService(s Service) error {
+	if pi, ok := s.(PostInitialisableService); ok {
+		return k.observe(PhasePostInit, s, pi.PostInit)
+	}
+	return nil
+}
+
+func (k *Kernel) start(ctx context.Context, services util.Iterator[Service]) error {
+	return services.ForEachFailFast(func(s Service) error {
+		return k.startService(ctx, s)
+	})
+}
+
+func (k *Kernel) startService(ctx context.Context, s Service) error {
+	// Start the service
+	var err error
+	switch ss := s.(type) {
+	case ContextStartableService:
+		err = k.observe(PhaseStart, s, func() error {
+			return ss.StartContext(ctx)
+		})
+	case StartableService:
+		err = k.observe(PhaseStart, s, ss.Start)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Add to stop list if necessary
+	if isStoppable(s) {
+		k.mutex.Lock()
+		stopping := k.stopping
+		if !stopping {
+			k.stopList.Add(s)
+		}
+		k.mutex.Unlock()
+
+		// The Stop phase has begun so it would never be stopped, e.g. when started lazily
+		if stopping {
+			err = fmt.Errorf("%s started once the kernel is stopping", serviceName(s))
+			stopCtx, cancel := context.WithTimeout(context.Background(), k.shutdownTimeout())
+			defer cancel()
+			return errors.Join(err, stopService(stopCtx, s))
+		}
+	}
+	return nil
+}
+
+// run runs each service in sequence. Those that run concurrently are started in their own goroutine.
+// The first failure cancels the root context and begins the Stop phase, so that others can exit even if they
+// only return once stopped, with all errors being returned.
+func (k *Kernel) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mutex   sync.Mutex
+		errs    []error
+		stopped chan error
+	)
+
+	fail := func(err error) {
+		if err == nil {
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		errs = append(errs, err)
+		cancel()
+
+		// The first failure stops the started services, without waiting for those still running
+		if stopped == nil {
+			if _, rootCancel := k.rootContext(); rootCancel != nil {
+				rootCancel(err)
 			}
+			stopped = make(chan error, 1)
+			go func() {
+				stopped <- k.stop()
+			}()
 		}
+	}
+
+	// Use a snapshot of the services as lazy injection can deploy more whilst running
+	k.indexMutex.RLock()
+	services := k.services.Iterator()
+	k.indexMutex.RUnlock()
 
-		// Add to stop list if necessary
-		if ss, ok := s.(StoppableService); ok {
-			instance.stopList.Add(ss)
+	services.ForEach(func(s Service) {
+		// Once cancelled do not run any further services
+		if ctx.Err() != nil {
+			return
 		}
-		return nil
-	})
-}
 
-func (k *Kernel) stop() {
-	instance.stopList.ReverseIterator().ForEach(func(i Service) {
-		(i).(StoppableService).Stop()
+		if k.isConcurrent(s) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				fail(k.runService(ctx, s))
+			}()
+		} else {
+			fail(k.runService(ctx, s))
+		}
 	})
+
+	wg.Wait()
+
+	// Include any errors from stopping the services after a failure
+	if stopped != nil {
+		if err := <-stopped; err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
 }
 
-func (k *Kernel) run() error {
-	return instance.services.ForEachFailFast(func(s Service) error {
-		if rs, ok := s.(RunnableService); ok {
-			if err := rs.Run(); err != nil {
-				return err
-			}
+func (k *Kernel) isConcurrent(s Service) bool {
+	switch s.(type) {
+	case ContextRunnableService, RunnableService:
+		if cs, ok := s.(ConcurrentRunnableService); ok {
+			return cs.RunConcurrently()
 		}
+		return k.concurrent
+	default:
+		// Not runnable so don't bother with a goroutine
+		return false
+	}
+}
+
+func (k *Kernel) runService(ctx context.Context, s Service) error {
+	var err error
+	if ss, ok := s.(SupervisedService); ok {
+		err = k.Supervise(ctx, serviceName(s), ss.RestartPolicy(), func(ctx context.Context) error {
+			return k.runServiceOnce(ctx, s)
+		})
+	} else {
+		err = k.runServiceOnce(ctx, s)
+	}
+
+	// A service exiting because it was cancelled is not a failure
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		err = nil
+	}
+	return err
+}
+
+func (k *Kernel) runServiceOnce(ctx context.Context, s Service) error {
+	switch rs := s.(type) {
+	case ContextRunnableService:
+		return k.observe(PhaseRun, s, func() error {
+			return rs.RunContext(ctx)
+		})
+	case RunnableService:
+		return k.observe(PhaseRun, s, rs.Run)
+	default:
 		return nil
-	})
+	}
 }
@@ -110,3 +110,73 @@ func TestEmptyKernel(t *testing.T) {
 	}
 
 }
+
+// testFlagService declares a flag so that two kernels deploying it would clash
+// if they shared the same flag.FlagSet
+type testFlagService struct {
+	name *string `kernel:"flag,name,Name of service,default"`
+	testService
+}
+
+// TestNewKernel_Isolated runs two independent kernels in parallel
+func TestNewKernel_Isolated(t *testing.T) {
+	type result struct {
+		s   *testFlagService
+		err error
+	}
+
+	results := make(chan result, 2)
+	for _, name := range []string{"a", "b"} {
+		go func(name string) {
+			s := &testFlagService{}
+			k := NewKernel()
+			k.SetArgs("-name", name)
+			err := k.DependsOn(s)
+			if err == nil {
+				err = k.Run()
+			}
+			results <- result{s: s, err: err}
+		}(name)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("Run failed: %v", r.err)
+		}
+		if !r.s.start || !r.s.run || !r.s.stop {
+			t.Errorf("service lifecycle incomplete start=%v run=%v stop=%v", r.s.start, r.s.run, r.s.stop)
+		}
+		seen[*r.s.name] = true
+	}
+
+	if !seen["a"] || !seen["b"] {
+		t.Errorf("flags not isolated between kernels, got %v", seen)
+	}
+
+	// Neither kernel should have touched the global one
+	if !instance.services.IsEmpty() {
+		t.Errorf("global kernel was modified")
+	}
+}
+
+// TestKernel_Shutdown ensures services are stopped only once
+func TestKernel_Shutdown(t *testing.T) {
+	k := NewKernel()
+	s := &testService{}
+	if err := k.DependsOn(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.stop = false
+	if err := k.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if s.stop {
+		t.Errorf("service stopped twice")
+	}
+}
@@ -0,0 +1,208 @@
+// Package kerneltest provides a harness for testing services within an isolated kernel.
+//
+// Unlike kernel.Launch, each Harness has its own kernel and flag.FlagSet so tests can run in parallel.
+// The lifecycle can be run one phase at a time, with mocks replacing any service or API:
+//
+//	func TestServer(t *testing.T) {
+//		store := &mockStore{}
+//		server := &Server{}
+//
+//		h := kerneltest.New(t).
+//			OverrideAPI((*Store)(nil), store).
+//			Args("-port", "0").
+//			Config("server:\n  name: test\n").
+//			Init(server).
+//			PostInit().
+//			Start()
+//
+//		// test server here
+//
+//		h.Stop().AssertStopOrder(server, store)
+//	}
+package kerneltest
+
+import (
+	"context"
+	"github.com/peter-mount/go-kernel/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Harness runs services within an isolated kernel.
+//
+// Any failure is reported with t.Fatal, so the methods can be chained.
+// The kernel is shut down when the test completes.
+type Harness struct {
+	t       testing.TB
+	kernel  *kernel.Kernel
+	args    []string         // Command line arguments
+	config  string           // Config file, "" for none
+	mutex   sync.Mutex       // Guards stopped
+	stopped []kernel.Service // Services in the order they were stopped
+}
+
+// New creates a Harness with a new kernel
+func New(t testing.TB) *Harness {
+	h := &Harness{
+		t:      t,
+		kernel: kernel.NewKernel(),
+	}
+
+	if err := h.kernel.AddListener(h); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = h.kernel.Shutdown()
+	})
+
+	return h
+}
+
+// Kernel returns the kernel being tested
+func (h *Harness) Kernel() *kernel.Kernel {
+	return h.kernel
+}
+
+// Override replaces a service with a mock of the same type, so it is injected instead of a new instance.
+// The mock's fields are not injected and Init is not called. This must be called before Init.
+func (h *Harness) Override(mock kernel.Service) *Harness {
+	h.t.Helper()
+	if err := h.kernel.Override(mock); err != nil {
+		h.t.Fatal(err)
+	}
+	return h
+}
+
+// OverrideAPI registers a mock as the implementation of an API, e.g. OverrideAPI((*Store)(nil), mock).
+// As with Override the mock's fields are not injected and Init is not called. This must be called before Init.
+func (h *Harness) OverrideAPI(api interface{}, mock kernel.Service) *Harness {
+	h.t.Helper()
+	if err := h.kernel.OverrideAPI(api, mock); err != nil {
+		h.t.Fatal(err)
+	}
+	return h
+}
+
+// OverrideNamedAPI registers a mock as a named implementation of an API.
+// As with Override the mock's fields are not injected and Init is not called. This must be called before Init.
+func (h *Harness) OverrideNamedAPI(api interface{}, name string, mock kernel.Service) *Harness {
+	h.t.Helper()
+	if err := h.kernel.OverrideNamedAPI(api, name, mock); err != nil {
+		h.t.Fatal(err)
+	}
+	return h
+}
+
+// Args sets the command line arguments, which are parsed by PostInit
+func (h *Harness) Args(args ...string) *Harness {
+	h.args = args
+	return h
+}
+
+// Config sets the content of the config file, in yaml, used by any service with kernel:"config" fields.
+// It is written to a temporary file which is passed with the -config flag.
+func (h *Harness) Config(yaml string) *Harness {
+	h.t.Helper()
+	h.config = filepath.Join(h.t.TempDir(), "config.yaml")
+	if err := os.WriteFile(h.config, []byte(yaml), 0644); err != nil {
+		h.t.Fatal(err)
+	}
+	return h
+}
+
+// Init deploys services in the kernel, injecting their dependencies and calling Init
+func (h *Harness) Init(services ...kernel.Service) *Harness {
+	h.t.Helper()
+	if err := h.kernel.DependsOn(services...); err != nil {
+		h.t.Fatal(err)
+	}
+	return h
+}
+
+// PostInit parses the arguments then runs the PostInit phase
+func (h *Harness) PostInit() *Harness {
+	h.t.Helper()
+	h.setArgs()
+	if err := h.kernel.PostInit(); err != nil {
+		h.t.Fatal(err)
+	}
+	return h
+}
+
+// Start runs the Start phase
+func (h *Harness) Start() *Harness {
+	h.t.Helper()
+	if err := h.kernel.Start(context.Background()); err != nil {
+		h.t.Fatal(err)
+	}
+	return h
+}
+
+// Run runs the whole lifecycle after Init, returning any error from the kernel.
+// This is an alternative to calling PostInit and Start.
+func (h *Harness) Run() error {
+	h.setArgs()
+	return h.kernel.Run()
+}
+
+// setArgs passes the arguments to the kernel, adding -config if a service uses the config
+func (h *Harness) setArgs() {
+	args := h.args
+	if h.config != "" && h.kernel.FlagSet().Lookup("config") != nil {
+		args = append([]string{"-config", h.config}, args...)
+	}
+	h.kernel.SetArgs(args...)
+}
+
+// Stop stops any started services, failing the test if any returned an error
+func (h *Harness) Stop() *Harness {
+	h.t.Helper()
+	if err := h.kernel.Shutdown(); err != nil {
+		h.t.Fatal(err)
+	}
+	return h
+}
+
+// Stopped returns the services which have been stopped, in the order they were stopped
+func (h *Harness) Stopped() []kernel.Service {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]kernel.Service(nil), h.stopped...)
+}
+
+// AssertStopOrder fails the test unless exactly the expected services were stopped in that order
+func (h *Harness) AssertStopOrder(expected ...kernel.Service) *Harness {
+	h.t.Helper()
+
+	stopped := h.Stopped()
+	if len(stopped) != len(expected) {
+		h.t.Errorf("expected %d services to stop, got %d", len(expected), len(stopped))
+		return h
+	}
+
+	for i, s := range expected {
+		if stopped[i] != s {
+			h.t.Errorf("expected service %d to stop to be %T, got %T", i, s, stopped[i])
+		}
+	}
+	return h
+}
+
+// PhaseChanged implements kernel.LifecycleListener
+func (h *Harness) PhaseChanged(kernel.Phase) {}
+
+// BeforeService implements kernel.LifecycleListener
+func (h *Harness) BeforeService(kernel.Phase, kernel.Service) {}
+
+// AfterService implements kernel.LifecycleListener, recording the order services are stopped
+func (h *Harness) AfterService(phase kernel.Phase, s kernel.Service, _ time.Duration, _ error) {
+	if phase == kernel.PhaseStop {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		h.stopped = append(h.stopped, s)
+	}
+}
@@ -0,0 +1,200 @@
+package kernel
+
+import (
+	"bytes"
+	"context"
+	"github.com/peter-mount/go-kernel/v2/util/injection"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// injectLazy injects a func which resolves the service the first time it's called.
+//
+// The func must be either func() T or func() (T, error). For the former any error will cause a panic.
+func (k *Kernel) injectLazy(opts injectOptions, ip *injection.Point) error {
+	ft := ip.StructField().Type
+	if ft.Kind() != reflect.Func || ft.NumIn() != 0 ||
+		!(ft.NumOut() == 1 || (ft.NumOut() == 2 && ft.Out(1) == errorType)) {
+		return ip.Errorf("lazy requires func() T or func() (T, error)")
+	}
+
+	// Record the dependency now as there won't be a dependent when it's resolved
+	k.recordDependency(getQualifiedServiceName(ip.Type(), opts.name))
+
+	// The service the func is injected into
+	var owner string
+	if n := len(k.deploying); n > 0 {
+		owner = k.deploying[n-1].To
+	}
+
+	var (
+		once     sync.Once
+		resolved Service
+		err      error
+	)
+
+	fn := reflect.MakeFunc(ft, func(_ []reflect.Value) []reflect.Value {
+		once.Do(func() {
+			resolved, err = k.resolveLazy(owner, opts, ip)
+		})
+
+		v := reflect.Zero(ft.Out(0))
+		if resolved != nil {
+			v = reflect.ValueOf(resolved).Convert(ft.Out(0))
+		}
+
+		if ft.NumOut() == 1 {
+			if err != nil {
+				panic(err)
+			}
+			return []reflect.Value{v}
+		}
+
+		ev := reflect.Zero(errorType)
+		if err != nil {
+			ev = reflect.ValueOf(&err).Elem()
+		}
+		return []reflect.Value{v, ev}
+	})
+
+	ip.Get().Set(fn)
+	return nil
+}
+
+// lazyStart is closed once the services deployed by a lazy injection have been started
+type lazyStart struct {
+	done chan struct{}
+	err  error
+}
+
+// resolveLazy resolves a lazily injected service.
+//
+// If the kernel is still deploying services then this is the same as a normal injection.
+// Once the kernel is read only any services deployed as a result are PostInit'ed immediately. Before the Start
+// phase they are then started with the rest of the kernel, otherwise they are started immediately and will be
+// stopped with the rest of the kernel, but do not take part in the Run phase.
+// Once the kernel is stopping this returns an error, as anything started would not be stopped.
+//
+// lazyMutex is only held whilst deploying, so the services being started can resolve their own lazy dependencies.
+// Anything else resolving one of those services waits until they have started.
+func (k *Kernel) resolveLazy(owner string, opts injectOptions, ip *injection.Point) (Service, error) {
+	// Called whilst its owner is being deployed, e.g. from its Init, so this goroutine already holds lazyMutex
+	// or the kernel is not yet running
+	if owner != "" && k.dependencies.Contains(owner) {
+		return k.resolveService(opts, ip)
+	}
+
+	// Called whilst this goroutine is deploying lazily, e.g. from the Init of a service already deployed,
+	// so it already holds lazyMutex. Anything deployed is started along with the rest of that deployment
+	if k.lazyDeployer.Load() == goroutineID() {
+		return k.resolveService(opts, ip)
+	}
+
+	k.lazyMutex.Lock()
+
+	if !k.readOnly {
+		defer k.lazyMutex.Unlock()
+		return k.deployLazy(opts, ip)
+	}
+
+	// Anything started now would not be stopped
+	if k.stopping {
+		k.lazyMutex.Unlock()
+		return nil, ip.Errorf("cannot deploy %s lazily once the kernel is stopping", ip.Type())
+	}
+
+	// Before the Start phase anything deployed now is started with the rest of the kernel
+	ctx, _ := k.rootContext()
+
+	before := k.services.Size()
+	resolved, err := k.deployLazy(opts, ip)
+
+	// Either we start what has just been deployed, or wait for whoever deployed it to start it
+	var deployed []Service
+	for i := before; i < k.services.Size(); i++ {
+		deployed = append(deployed, k.services.Get(i))
+	}
+
+	// Don't wait if called whilst the owner is itself being started, as it may be what we'd wait for
+	starting := k.lazyStarts[resolved]
+	if owner, exists := k.index[owner]; exists && k.lazyStarts[owner] != nil {
+		starting = nil
+	}
+
+	if err == nil && len(deployed) > 0 {
+		starting = &lazyStart{done: make(chan struct{})}
+		for _, s := range deployed {
+			k.lazyStarts[s] = starting
+		}
+	}
+
+	k.lazyMutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deployed) > 0 {
+		starting.err = k.startLazy(ctx, deployed)
+
+		k.lazyMutex.Lock()
+		for _, s := range deployed {
+			delete(k.lazyStarts, s)
+		}
+		k.lazyMutex.Unlock()
+
+		close(starting.done)
+	} else if starting != nil {
+		<-starting.done
+	}
+
+	if starting != nil && starting.err != nil {
+		return nil, starting.err
+	}
+	return resolved, nil
+}
+
+// deployLazy resolves a lazily injected service whilst holding lazyMutex, recording this goroutine as the one
+// deploying so that any lazy func it calls does not try to lock lazyMutex again
+func (k *Kernel) deployLazy(opts injectOptions, ip *injection.Point) (Service, error) {
+	k.lazyDeployer.Store(goroutineID())
+	defer k.lazyDeployer.Store(0)
+	return k.resolveService(opts, ip)
+}
+
+// goroutineID returns the id of the current goroutine, taken from the header of its stack trace
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// startLazy brings services deployed lazily up to the same lifecycle phase as the rest of the kernel.
+// If ctx is nil then the Start phase has yet to begin, so they are only PostInit'ed.
+func (k *Kernel) startLazy(ctx context.Context, services []Service) error {
+	for _, s := range services {
+		if err := k.postInitService(s); err != nil {
+			return err
+		}
+	}
+
+	// The Start phase will start them
+	if ctx == nil {
+		return nil
+	}
+
+	for _, s := range services {
+		if err := k.startService(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
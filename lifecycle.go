@@ -0,0 +1,90 @@
+package kernel
+
+import (
+	"time"
+)
+
+// Phase is a lifecycle phase of the kernel
+type Phase string
+
+const (
+	PhaseInit     Phase = "Init"     // Services are being deployed & Init'ed
+	PhasePostInit Phase = "PostInit" // Services are being PostInit'ed
+	PhaseStart    Phase = "Start"    // Services are being started
+	PhaseRun      Phase = "Run"      // Services are being run
+	PhaseStop     Phase = "Stop"     // Services are being stopped
+)
+
+// LifecycleListener is a Service, or an object added with Kernel.AddListener, which is notified as the kernel
+// moves between lifecycle phases and as each service is called within a phase.
+//
+// Listeners are called synchronously so should return quickly. In the Run phase they can be called
+// concurrently if services run concurrently.
+//
+// Services implementing LifecycleListener are found at the start of the PostInit phase, so only listeners
+// added with Kernel.AddListener before services are deployed are notified of the Init phase.
+type LifecycleListener interface {
+	// PhaseChanged is called when the kernel enters a new lifecycle phase
+	PhaseChanged(phase Phase)
+	// BeforeService is called before a service is called in a phase, e.g. before Start()
+	BeforeService(phase Phase, s Service)
+	// AfterService is called after a service has been called in a phase, with the time taken and
+	// any error it returned.
+	AfterService(phase Phase, s Service, d time.Duration, err error)
+}
+
+// AddListener adds a LifecycleListener to the kernel.
+// Services implementing LifecycleListener do not need to be added, they are found automatically.
+func (k *Kernel) AddListener(l LifecycleListener) error {
+	if err := k.assertAmendable(); err != nil {
+		return err
+	}
+	k.listeners = append(k.listeners, l)
+	return nil
+}
+
+// collectListeners adds any deployed services which are listeners
+func (k *Kernel) collectListeners() {
+	k.services.ForEach(func(s Service) {
+		if l, ok := s.(LifecycleListener); ok {
+			k.listeners = append(k.listeners, l)
+		}
+	})
+}
+
+// initPhase enters the Init phase when the first service is deployed
+func (k *Kernel) initPhase() {
+	k.mutex.Lock()
+	first := k.phase == ""
+	k.mutex.Unlock()
+
+	if first {
+		k.phaseChanged(PhaseInit)
+	}
+}
+
+func (k *Kernel) phaseChanged(phase Phase) {
+	k.mutex.Lock()
+	k.phase = phase
+	k.mutex.Unlock()
+
+	for _, l := range k.listeners {
+		l.PhaseChanged(phase)
+	}
+}
+
+// observe calls f, notifying any listeners before and after
+func (k *Kernel) observe(phase Phase, s Service, f func() error) error {
+	for _, l := range k.listeners {
+		l.BeforeService(phase, s)
+	}
+
+	start := time.Now()
+	err := f()
+	d := time.Since(start)
+
+	for _, l := range k.listeners {
+		l.AfterService(phase, s, d, err)
+	}
+	return err
+}
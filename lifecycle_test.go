@@ -0,0 +1,98 @@
+package kernel
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testListener records lifecycle events
+type testListener struct {
+	events []string
+}
+
+func (l *testListener) PhaseChanged(phase Phase) {
+	l.events = append(l.events, string(phase))
+}
+
+func (l *testListener) BeforeService(phase Phase, s Service) {
+	l.events = append(l.events, fmt.Sprintf("before %s %s", phase, serviceName(s)))
+}
+
+func (l *testListener) AfterService(phase Phase, s Service, _ time.Duration, err error) {
+	l.events = append(l.events, fmt.Sprintf("after %s %s %v", phase, serviceName(s), err))
+}
+
+func TestKernel_LifecycleListener(t *testing.T) {
+	l := &testListener{}
+	k := NewKernel()
+	if err := k.AddListener(l); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.DependsOn(&testService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"Init",
+		"PostInit",
+		"Start",
+		"before Start testService",
+		"after Start testService <nil>",
+		"Run",
+		"before Run testService",
+		"after Run testService <nil>",
+		"Stop",
+		"before Stop testService",
+		"after Stop testService <nil>",
+	}
+	if strings.Join(l.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(l.events, "\n"))
+	}
+}
+
+// TestKernel_LifecycleListenerInit ensures calls to Init are observed
+func TestKernel_LifecycleListenerInit(t *testing.T) {
+	l := &testListener{}
+	k := NewKernel()
+	if err := k.AddListener(l); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.DependsOn(&testService2{t: t}); err != nil {
+		t.Fatal(err)
+	}
+
+	// testService is deployed by testService2's Init
+	expected := []string{
+		"Init",
+		"before Init testService2",
+		"after Init testService2 <nil>",
+	}
+	if strings.Join(l.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(l.events, "\n"))
+	}
+}
+
+// testListenerService is a service which is also a listener
+type testListenerService struct {
+	testListener
+}
+
+func TestKernel_LifecycleListenerService(t *testing.T) {
+	l := &testListenerService{}
+	k := NewKernel()
+	if err := k.DependsOn(l); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(l.events, ",") != "PostInit,Start,Run,Stop" {
+		t.Errorf("unexpected events %v", l.events)
+	}
+}
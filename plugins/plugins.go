@@ -0,0 +1,101 @@
+// Package plugins loads services from Go plugins, so optional integrations can be added to an application
+// without rebuilding it.
+//
+// This is a separate package as importing "plugin" dynamically links the application against libc,
+// so only applications which deploy the Loader pay for it:
+//
+//	func main() {
+//		if err := kernel.Launch(&plugins.Loader{}, &App{}); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+package plugins
+
+import (
+	"fmt"
+	"github.com/peter-mount/go-kernel/v2"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sort"
+)
+
+const (
+	// pluginsFlag is the flag used to set the directory plugins are loaded from
+	pluginsFlag = "plugins"
+	// pluginServices is the function a plugin must export
+	pluginServices = "Services"
+)
+
+// Loader loads every plugin in the directory set with the -plugins flag, or its environment variable,
+// before the command line is parsed so that plugins can declare flags of their own.
+type Loader struct {
+	dir *string `kernel:"flag,plugins,Directory to load plugins from"`
+}
+
+func (l *Loader) Describe() string {
+	return "Plugins"
+}
+
+func (l *Loader) BeforeParse(k *kernel.Kernel) error {
+	if dir := k.PeekFlag(pluginsFlag); dir != "" {
+		return Load(k, dir)
+	}
+	return nil
+}
+
+// Load loads every Go plugin, a file ending in .so, in a directory in lexical order.
+// See LoadPlugin.
+func Load(k *kernel.Kernel, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".so" {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := LoadPlugin(k, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadPlugin loads a Go plugin built with "go build -buildmode=plugin" and deploys its services.
+//
+// The plugin must export a Services function returning the services to deploy, which are deployed
+// with DependsOn, e.g.
+//
+//	func Services() []kernel.Service {
+//		return []kernel.Service{&MyIntegration{}}
+//	}
+//
+// The plugin must be built with the same version of Go and of this module as the application.
+func LoadPlugin(k *kernel.Kernel, path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", path, err)
+	}
+
+	sym, err := p.Lookup(pluginServices)
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", path, err)
+	}
+
+	services, ok := sym.(func() []kernel.Service)
+	if !ok {
+		return fmt.Errorf("plugin %s: %s must be a func() []kernel.Service, got %T", path, pluginServices, sym)
+	}
+
+	if err := k.DependsOn(services()...); err != nil {
+		return fmt.Errorf("plugin %s: %w", path, err)
+	}
+	return nil
+}
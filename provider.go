@@ -0,0 +1,140 @@
+package kernel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Provide registers constructor functions with the kernel.
+// If the kernel has been started then this will panic.
+//
+// See Kernel.Provide for details.
+func Provide(providers ...interface{}) {
+	for _, provider := range providers {
+		if err := instance.Provide(provider); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Provide registers a constructor function with the kernel.
+//
+// The function must be of the form func(deps...) T or func(deps...) (T, error) where T is either
+// a pointer or an interface. When a kernel:"inject" field of type T is injected and no service of that
+// type has been deployed, the function is called to create it.
+//
+// Each parameter of the function must also be a pointer or interface. These are resolved from the
+// kernel the same way as a kernel:"inject" field, so they can be services or other providers.
+//
+// The function is called when the field is injected, before the PostInit phase, so it must not rely on its
+// dependencies having been started. If it does then inject it with kernel:"inject,lazy" instead.
+//
+// The value returned is not injected nor has Init called, however it takes part in the remaining lifecycle
+// phases if it implements them, e.g. StoppableService.
+//
+// This allows third party types like *sql.DB or *http.Client to be injected without a wrapper service.
+func (k *Kernel) Provide(provider interface{}) error {
+	if err := k.assertAmendable(); err != nil {
+		return err
+	}
+
+	fv := reflect.ValueOf(provider)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return fmt.Errorf("provider %s is not a func", ft)
+	}
+
+	if !(ft.NumOut() == 1 || (ft.NumOut() == 2 && ft.Out(1) == errorType)) {
+		return fmt.Errorf("provider %s must return T or (T, error)", ft)
+	}
+
+	t, err := providedType(ft.Out(0))
+	if err != nil {
+		return fmt.Errorf("provider %s %v", ft, err)
+	}
+
+	for i := 0; i < ft.NumIn(); i++ {
+		if _, err := providedType(ft.In(i)); err != nil {
+			return fmt.Errorf("provider %s parameter %d %v", ft, i, err)
+		}
+	}
+
+	name := getServiceName(t)
+	if _, exists := k.providers[name]; exists {
+		return fmt.Errorf("provider for %s already registered", name)
+	}
+	if _, exists := k.index[name]; exists {
+		return fmt.Errorf("service %s already registered", name)
+	}
+
+	k.providers[name] = fv
+	return nil
+}
+
+// providedType returns the type used to resolve a provider's parameter or result
+func providedType(t reflect.Type) (reflect.Type, error) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return t.Elem(), nil
+	case reflect.Interface:
+		return t, nil
+	default:
+		return nil, errors.New("must be a pointer or interface")
+	}
+}
+
+// provide creates a service by calling its provider
+func (k *Kernel) provide(name string, provider reflect.Value) (Service, error) {
+	d := k.recordDependency(name)
+	if k.dependencies.Contains(name) {
+		return nil, k.cycleError(d)
+	}
+
+	ft := provider.Type()
+
+	// Resolve each parameter whilst this provider is marked as being deployed
+	k.dependencies.Add(name)
+	k.deploying = append(k.deploying, d)
+	args, err := k.provideArgs(ft)
+	k.deploying = k.deploying[:len(k.deploying)-1]
+	k.dependencies.Remove(name)
+	if err != nil {
+		return nil, err
+	}
+
+	out := provider.Call(args)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, fmt.Errorf("provider for %s: %w", name, out[1].Interface().(error))
+	}
+
+	if out[0].IsNil() {
+		return nil, fmt.Errorf("provider for %s returned nil", name)
+	}
+
+	s := out[0].Interface()
+	k.addDeployed(name, s)
+	return s, nil
+}
+
+func (k *Kernel) provideArgs(ft reflect.Type) ([]reflect.Value, error) {
+	var args []reflect.Value
+	for i := 0; i < ft.NumIn(); i++ {
+		pt := ft.In(i)
+		t, _ := providedType(pt)
+
+		// Record the parameter as the field for the dependency graph
+		k.via = &dependencyRef{field: fmt.Sprintf("arg%d", i), tag: "provide"}
+
+		s, err := k.resolveType(t, injectOptions{}, func(f string, a ...interface{}) error {
+			return fmt.Errorf("provider %s parameter %d: %s", ft, i, fmt.Sprintf(f, a...))
+		})
+		k.via = nil
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, reflect.ValueOf(s).Convert(pt))
+	}
+	return args, nil
+}
@@ -2,8 +2,9 @@ package kernel
 
 import (
 	"errors"
+	"flag"
 	"fmt"
-	"github.com/peter-mount/go-kernel/v2/util"
+	"os"
 	"reflect"
 )
 
@@ -16,12 +17,22 @@ func init() {
 	resetKernel()
 }
 
+// defaultUsage identifies flag.Usage before the application has replaced it
+var defaultUsage = reflect.ValueOf(flag.Usage).Pointer()
+
 func resetKernel() {
-	instance = &Kernel{
-		dependencies: util.NewSyncSet[Service](),
-		services:     util.NewList[Service](),
-		stopList:     util.NewList[Service](),
-		index:        make(map[string]Service),
+	// The singleton uses the global flag.CommandLine so flags can be declared by services
+	// using either the kernel:"flag" tag or the flag package directly
+	k := newKernel(flag.CommandLine, os.Args[1:])
+	instance = k
+
+	// Any flag.Usage set by the application takes precedence over the generated help
+	flag.CommandLine.Usage = func() {
+		if reflect.ValueOf(flag.Usage).Pointer() != defaultUsage {
+			flag.Usage()
+		} else {
+			k.usage()
+		}
 	}
 }
 
@@ -30,7 +41,7 @@ func resetKernel() {
 //
 // This is normally used within a packages' init() function to automatically deploy services.
 func Register(services ...Service) {
-	err := assertInstanceAmendable()
+	err := instance.assertAmendable()
 	if err == nil {
 		err = instance.DependsOn(services...)
 	}
@@ -42,25 +53,91 @@ func Register(services ...Service) {
 
 // RegisterAPI registers an API
 func RegisterAPI(api interface{}, service Service) {
-	err := assertInstanceAmendable()
+	RegisterNamedAPI(api, "", service)
+}
+
+// RegisterNamedAPI registers an API under a name, allowing multiple implementations of the same
+// interface to be registered.
+//
+// The service can then be injected with kernel:"inject,name=theName". All implementations of an
+// interface, named or not, can be injected into a slice or map[string] field with kernel:"inject,all".
+func RegisterNamedAPI(api interface{}, name string, service Service) {
+	err := instance.addAPI(api, name, service, false)
 	if err != nil {
 		panic(err)
 	}
+}
+
+// apiImplementation is a service registered against an API
+type apiImplementation struct {
+	name    string  // Name of the implementation, "" if unnamed
+	key     string  // The name the service is indexed under
+	service Service // The service
+}
+
+// RegisterAPI registers an API with this kernel. See RegisterAPI for the global kernel.
+func (k *Kernel) RegisterAPI(api interface{}, service Service) error {
+	return k.addAPI(api, "", service, false)
+}
+
+// RegisterNamedAPI registers an API under a name with this kernel. See RegisterNamedAPI for the global kernel.
+func (k *Kernel) RegisterNamedAPI(api interface{}, name string, service Service) error {
+	return k.addAPI(api, name, service, false)
+}
+
+// OverrideAPI registers an already initialised service as the implementation of an API, e.g. a mock within a test.
+// Like Override, its fields are not injected and Init is not called.
+func (k *Kernel) OverrideAPI(api interface{}, service Service) error {
+	return k.addAPI(api, "", service, true)
+}
+
+// OverrideNamedAPI registers an already initialised service as a named implementation of an API.
+// Like Override, its fields are not injected and Init is not called.
+func (k *Kernel) OverrideNamedAPI(api interface{}, name string, service Service) error {
+	return k.addAPI(api, name, service, true)
+}
+
+// addAPI registers a service against an API. If override then the service is added as is, as with Override.
+func (k *Kernel) addAPI(api interface{}, name string, service Service, override bool) error {
+	err := k.assertAmendable()
+	if err != nil {
+		return err
+	}
 
 	// api must be an interface
 	kt := reflect.TypeOf(api).Elem()
 	if kt.Kind() != reflect.Interface {
-		panic(errors.New("cannot register non-interface"))
+		return errors.New("cannot register non-interface")
 	}
 
-	name := getServiceName(kt)
+	if !reflect.TypeOf(service).Implements(kt) {
+		return fmt.Errorf("%T does not implement %s", service, kt)
+	}
+
+	apiName := getServiceName(kt)
+	key := getQualifiedServiceName(kt, name)
 
-	resolvedService, err := instance.addService(name, service, true)
+	if override {
+		err = k.override(key, service)
+	} else {
+		var resolvedService Service
+		resolvedService, err = k.addService(key, service, true)
+		if err == nil && resolvedService != service {
+			err = fmt.Errorf("service %s already registered", key)
+		}
+	}
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	if resolvedService != service {
-		panic(fmt.Errorf("service %s already registered", name))
+	k.apis[apiName] = append(k.apis[apiName], apiImplementation{name: name, key: key, service: service})
+	return nil
+}
+
+// getQualifiedServiceName returns the name a named API is indexed under
+func getQualifiedServiceName(t reflect.Type, name string) string {
+	if name == "" {
+		return getServiceName(t)
 	}
+	return getServiceName(t) + "#" + name
 }
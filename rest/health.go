@@ -0,0 +1,49 @@
+package rest
+
+import (
+	"github.com/peter-mount/go-kernel/v2"
+	"net/http"
+)
+
+// Health is a service which adds /healthz and /readyz endpoints to the Server.
+//
+// Both return the kernel.HealthReport of every deployed kernel.HealthCheckService.
+// /healthz returns 503 if any service is unhealthy, /readyz also returns 503 until
+// the kernel has reached the Run phase.
+//
+// To use simply include it when launching the kernel:
+//
+//	err := kernel.Launch( &rest.Health{}, &mylib.MyService{} )
+type Health struct {
+	server *Server `kernel:"inject"`
+	kernel *kernel.Kernel
+}
+
+func (h *Health) Init(k *kernel.Kernel) error {
+	h.kernel = k
+	return nil
+}
+
+func (h *Health) PostInit() error {
+	h.server.Handle("/healthz", h.healthz).Methods("GET")
+	h.server.Handle("/readyz", h.readyz).Methods("GET")
+	return nil
+}
+
+func (h *Health) healthz(r *Rest) error {
+	report := h.kernel.Health(r.Request().Context())
+	return h.send(r, report, report.Healthy)
+}
+
+func (h *Health) readyz(r *Rest) error {
+	report := h.kernel.Health(r.Request().Context())
+	return h.send(r, report, report.Ready)
+}
+
+func (h *Health) send(r *Rest, report *kernel.HealthReport, ok bool) error {
+	if !ok {
+		r.Status(http.StatusServiceUnavailable)
+	}
+	r.JSON().Value(report)
+	return nil
+}
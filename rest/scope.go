@@ -0,0 +1,38 @@
+package rest
+
+import (
+	"errors"
+	"github.com/peter-mount/go-kernel/v2"
+	"log"
+	"net/http"
+)
+
+// requestScope is middleware which runs each request within its own kernel.ScopeRequest Scope,
+// closing it once the request has been handled.
+func (s *Server) requestScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := s.kernel.NewScope(kernel.ScopeRequest)
+		defer func() {
+			if err := scope.Close(); err != nil {
+				log.Println(err)
+			}
+		}()
+
+		next.ServeHTTP(w, r.WithContext(scope.Context(r.Context())))
+	})
+}
+
+// Scope returns the kernel.ScopeRequest Scope of this request, nil if it was not handled by a Server
+func (r *Rest) Scope() *kernel.Scope {
+	return kernel.GetScope(r.request.Context())
+}
+
+// Inject injects the kernel:"inject" fields of v from the request's Scope,
+// e.g. those tagged with kernel:"inject,scope=request"
+func (r *Rest) Inject(v interface{}) error {
+	scope := r.Scope()
+	if scope == nil {
+		return errors.New("request has no scope")
+	}
+	return scope.Inject(v)
+}
@@ -1,8 +1,9 @@
 package rest
 
 import (
+	"context"
 	"crypto/tls"
-	"flag"
+	"errors"
 	"fmt"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -11,72 +12,87 @@ import (
 	"golang.org/x/net/http2/h2c"
 	"log"
 	"net/http"
-	"os"
-	"strconv"
 )
 
 // Server The internal config of a Server
 type Server struct {
 	daemon        *kernel.Daemon `kernel:"inject"`
+	kernel        *kernel.Kernel
 	Headers       []string       // The permitted headers
 	Origins       []string       // The permitted Origins
 	Methods       []string       // The permitted methods
 	Address       string         // Address to bind to, "" for any
-	NoFlags       bool           // true to disable command line flags
+	NoFlags       bool           // true to not declare the rest-* command line flags
 	Port          int            // Port to listen to
-	port          *int           // Port from command line
+	flags         *serverFlags   // The command line flags, nil if NoFlags
 	router        *mux.Router    // The mux Router
 	ctx           *ServerContext // Base Context
-	protocol      *string        // server type
-	certFile      *string        // ssl cert
-	keyFile       *string        // ssl key
-	logConsole    *bool          // Logging
-	disableServer *bool          // Flag to disable server on command line
+	protocol      string         // server type
+	certFile      string         // ssl cert
+	keyFile       string         // ssl key
+	logConsole    bool           // Logging
+	disableServer bool           // true to disable the server
 }
 
-func (s *Server) Init(_ *kernel.Kernel) error {
+// serverFlags holds the command line flags of a Server
+type serverFlags struct {
+	port          *int    // Port from command line
+	protocol      *string // server type
+	certFile      *string // ssl cert
+	keyFile       *string // ssl key
+	logConsole    *bool   // Logging
+	disableServer *bool   // Flag to disable server on command line
+}
+
+func (s *Server) Init(k *kernel.Kernel) error {
+	s.kernel = k
+
 	if !s.NoFlags {
-		s.logConsole = flag.Bool("rest-log", false, "Log requests to console")
-		s.protocol = flag.String("rest-protocol", "http", "Protocol to use: http|https|h2|h2c")
-		s.port = flag.Int("rest-port", 0, "Port to use for http")
-		s.certFile = flag.String("rest-cert", "", "TLS Certificate File")
-		s.keyFile = flag.String("rest-key", "", "TLS Key File")
-		s.disableServer = flag.Bool("rest-disable", false, "Disable the rest server, use for tools that run the service")
+		fs := k.FlagSet()
+		s.flags = &serverFlags{
+			logConsole:    fs.Bool("rest-log", false, "Log requests to console"),
+			protocol:      fs.String("rest-protocol", "http", "Protocol to use: http|https|h2|h2c"),
+			port:          fs.Int("rest-port", 0, "Port to use for http"),
+			certFile:      fs.String("rest-cert", "", "TLS Certificate File"),
+			keyFile:       fs.String("rest-key", "", "TLS Key File"),
+			disableServer: fs.Bool("rest-disable", false, "Disable the rest server when used by tools that run the service"),
+		}
+
+		k.SetFlagEnv("rest-port", "RESTPORT")
+		k.SetFlagEnv("rest-protocol", "RESTPROTOCOL")
+		k.SetFlagEnv("rest-cert", "RESTCERT")
+		k.SetFlagEnv("rest-key", "RESTKEY")
 	}
 	return nil
 }
 
 func (s *Server) PostInit() error {
-	// Set port from command line arg or env var
-	if *s.port < 1 || *s.port > 65534 {
-		p, err := strconv.Atoi(os.Getenv("RESTPORT"))
-		if err == nil {
-			*s.port = p
+	s.protocol = "http"
+
+	if s.flags != nil {
+		// Set port from command line arg or env var
+		if *s.flags.port > 0 && *s.flags.port < 65535 {
+			s.Port = *s.flags.port
 		}
-	}
-	if *s.port > 0 && *s.port < 65535 {
-		s.Port = *s.port
-	}
 
-	// Set protocol
-	if *s.protocol == "" {
-		*s.protocol = os.Getenv("RESTPROTOCOL")
-	}
-	if *s.protocol != "http" && *s.protocol != "https" && *s.protocol != "h2" && *s.protocol != "h2c" {
-		return fmt.Errorf("Invalid protocol \"%s\"", *s.protocol)
+		s.protocol = *s.flags.protocol
+		s.certFile = *s.flags.certFile
+		s.keyFile = *s.flags.keyFile
+		s.logConsole = *s.flags.logConsole
+		s.disableServer = s.disableServer || *s.flags.disableServer
 	}
 
-	if *s.certFile == "" {
-		*s.certFile = os.Getenv("RESTCERT")
-	}
-	if *s.keyFile == "" {
-		*s.keyFile = os.Getenv("RESTKEY")
+	// Set protocol
+	if s.protocol != "http" && s.protocol != "https" && s.protocol != "h2" && s.protocol != "h2c" {
+		return fmt.Errorf("Invalid protocol \"%s\"", s.protocol)
 	}
 
 	s.router = mux.NewRouter()
 	s.ctx = &ServerContext{context: "", server: s}
 
-	if *s.logConsole {
+	s.router.Use(s.requestScope)
+
+	if s.logConsole {
 		s.router.Use(ConsoleLogger())
 	}
 
@@ -85,7 +101,7 @@ func (s *Server) PostInit() error {
 
 func (s *Server) Start() error {
 	// Disable the server if asked
-	if *s.disableServer {
+	if s.disableServer {
 		return nil
 	}
 
@@ -99,9 +115,21 @@ func (s *Server) Use(handler mux.MiddlewareFunc) {
 	s.router.Use(handler)
 }
 
+// RunConcurrently ensures the server does not prevent other services from running
+func (s *Server) RunConcurrently() bool {
+	return true
+}
+
+// Run runs the server until it fails. This is the same as RunContext(context.Background())
 func (s *Server) Run() error {
+	return s.RunContext(context.Background())
+}
+
+// RunContext runs the server until it fails or ctx is cancelled, in which case
+// the server is shutdown gracefully.
+func (s *Server) RunContext(ctx context.Context) error {
 	// Disable the server if asked
-	if *s.disableServer {
+	if s.disableServer {
 		return nil
 	}
 
@@ -130,7 +158,7 @@ func (s *Server) Run() error {
 	bindingAddress := fmt.Sprintf("%s:%d", s.Address, port)
 	var server *http.Server
 	serveTls := false
-	switch *s.protocol {
+	switch s.protocol {
 	// http/1.1
 	case "http":
 		serveTls = false
@@ -169,18 +197,31 @@ func (s *Server) Run() error {
 
 	// Should not occur unless we start supporting alternate protocols
 	default:
-		return fmt.Errorf("Protocol %s is currently unsupported", *s.protocol)
+		return fmt.Errorf("Protocol %s is currently unsupported", s.protocol)
 	}
 
-	log.Printf("Listening on %s for %s", bindingAddress, *s.protocol)
+	// Shutdown the server once the kernel cancels the context
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	log.Printf("Listening on %s for %s", bindingAddress, s.protocol)
+	var err error
 	if serveTls {
-		return server.ListenAndServeTLS(*s.certFile, *s.keyFile)
+		err = server.ListenAndServeTLS(s.certFile, s.keyFile)
 	} else {
-		return server.ListenAndServe()
+		err = server.ListenAndServe()
+	}
+
+	// Not an error if we have been shutdown
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
 	}
+	return err
 }
 
 // Disable allows a client to disable rest - e.g. for batch work
 func (s *Server) Disable() {
-	*s.disableServer = true
+	s.disableServer = true
 }
@@ -0,0 +1,282 @@
+package kernel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/peter-mount/go-kernel/v2/util/injection"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	ScopeRequest = "request" // The scope of a rest request
+	ScopeTask    = "task"    // The scope of a task run by the Worker
+)
+
+// Scope is a short-lived container derived from the kernel, e.g. for a single rest request or task.
+//
+// A field tagged kernel:"inject,scope=request" is injected with an instance which is created the first time
+// it's required within a scope named "request", and shared by everything injected from that scope.
+// Each instance is injected and its Init called in the same way as a service, and it is stopped
+// when the scope is closed. Any other kernel:"inject" field is injected with the service deployed in the kernel.
+//
+// This allows per-request state like a database transaction or the authenticated user to be injected,
+// e.g.
+//
+//	type orders struct {
+//		db   *Database `kernel:"inject"`
+//		tx   *Tx       `kernel:"inject,scope=request"`
+//		user *User     `kernel:"inject,scope=request"`
+//	}
+//
+//	func (s *Service) list(r *rest.Rest) error {
+//		h := &orders{}
+//		if err := r.Inject(h); err != nil {
+//			return err
+//		}
+//		...
+//	}
+type Scope struct {
+	kernel    *Kernel
+	name      string             // Name of the scope
+	mutex     sync.Mutex         // Guards the following
+	index     map[string]Service // Instances by type
+	instances []Service          // Instances in the order they were created
+	deploying map[string]bool    // Types currently being created, to detect cycles
+	closed    bool               // true once Close has been called
+}
+
+// NewScope creates a new Scope. Close must be called once it's no longer required.
+func (k *Kernel) NewScope(name string) *Scope {
+	return &Scope{kernel: k, name: name}
+}
+
+// Name returns the name of the scope
+func (s *Scope) Name() string {
+	return s.name
+}
+
+// scopeKey is the context key of a Scope
+type scopeKey struct{}
+
+// Context returns a copy of ctx containing the scope, so it can be retrieved with GetScope
+func (s *Scope) Context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopeKey{}, s)
+}
+
+// GetScope returns the Scope contained in this Context, nil if none
+func GetScope(ctx context.Context) *Scope {
+	if s, ok := ctx.Value(scopeKey{}).(*Scope); ok {
+		return s
+	}
+	return nil
+}
+
+// Add adds an existing instance to the scope, so that it's injected instead of a new instance being created,
+// e.g. the authenticated user by a middleware.
+// Like Kernel.Override its fields are not injected and Init is not called, but it is stopped when the scope is closed.
+func (s *Scope) Add(v Service) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot add %T to scope %s, must be a pointer to a struct", v, s.name)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("scope %s is closed", s.name)
+	}
+
+	name := getServiceName(t.Elem())
+	if _, exists := s.index[name]; exists {
+		return fmt.Errorf("%s already in scope %s", name, s.name)
+	}
+
+	s.add(name, v)
+	return nil
+}
+
+func (s *Scope) add(name string, v Service) {
+	if s.index == nil {
+		s.index = make(map[string]Service)
+	}
+	s.index[name] = v
+	s.instances = append(s.instances, v)
+}
+
+// Inject injects the kernel:"inject" fields of v, which must be a pointer to a struct.
+// Fields with the scope option matching this scope's name are injected from the scope, creating
+// an instance if required.
+func (s *Scope) Inject(v interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("scope %s is closed", s.name)
+	}
+	return s.inject(v)
+}
+
+func (s *Scope) inject(v interface{}) error {
+	tv := reflect.ValueOf(v)
+	t := tv.Type()
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot inject %T, must be a pointer to a struct", v)
+	}
+
+	elem := t.Elem()
+	for f := 0; f < elem.NumField(); f++ {
+		sf := elem.Field(f)
+		if sk, ok := sf.Tag.Lookup("kernel"); ok {
+			ip, err := injection.Of(f, sf, tv)
+			if err == nil {
+				err = s.injectField(sk, ip)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// injectField injects a field from either the scope or the kernel
+func (s *Scope) injectField(tag string, ip *injection.Point) error {
+	tags := strings.Split(tag, ",")
+	switch tags[0] {
+	case "-":
+		return nil
+	case "inject":
+	default:
+		return ip.Errorf("kernel:%q is not supported in scope %s", tags[0], s.name)
+	}
+
+	if ip.IsValue() {
+		return ip.Errorf("must be a pointer")
+	}
+
+	opts, err := parseInjectOptions(tags[1:], ip)
+	if err != nil {
+		return err
+	}
+
+	if opts.all || opts.lazy {
+		return ip.Errorf("all and lazy are not supported in scope %s", s.name)
+	}
+
+	var resolved Service
+	if opts.scope != "" {
+		resolved, err = s.resolveScoped(opts, ip)
+	} else {
+		resolved, err = s.kernel.lookupService(ip.Type(), opts, ip.Errorf)
+	}
+	if err == nil && resolved != nil {
+		ip.Set(resolved)
+	}
+	return err
+}
+
+// resolveScoped returns the instance in the scope for an injection point, creating it if required
+func (s *Scope) resolveScoped(opts injectOptions, ip *injection.Point) (Service, error) {
+	if opts.scope != s.name {
+		return nil, ip.Errorf("scope %s required but injecting from scope %s", opts.scope, s.name)
+	}
+
+	t := ip.Type()
+	if ip.StructField().Type.Kind() != reflect.Ptr || t.Kind() != reflect.Struct {
+		return nil, ip.Errorf("scope requires a pointer to a struct")
+	}
+
+	name := getServiceName(t)
+	if v, exists := s.index[name]; exists {
+		return v, nil
+	}
+
+	if opts.optional {
+		return nil, nil
+	}
+
+	if s.deploying[name] {
+		return nil, ip.Errorf("circular dependency on %s in scope %s", name, s.name)
+	}
+	if s.deploying == nil {
+		s.deploying = make(map[string]bool)
+	}
+	s.deploying[name] = true
+	defer delete(s.deploying, name)
+
+	v := reflect.New(t).Interface()
+	if err := s.inject(v); err != nil {
+		return nil, err
+	}
+
+	if is, ok := v.(InitialisableService); ok {
+		if err := is.Init(s.kernel); err != nil {
+			return nil, err
+		}
+	}
+
+	s.add(name, v)
+	return v, nil
+}
+
+// Close stops every stoppable instance in the scope in the reverse order they were created.
+// Once closed, nothing more can be injected from the scope. It is safe to call this more than once.
+//
+// The returned error contains every error returned by an instance whilst stopping.
+func (s *Scope) Close() error {
+	s.mutex.Lock()
+	instances := s.instances
+	s.instances = nil
+	s.index = nil
+	s.closed = true
+	s.mutex.Unlock()
+
+	var stoppable []Service
+	for i := len(instances) - 1; i >= 0; i-- {
+		if isStoppable(instances[i]) {
+			stoppable = append(stoppable, instances[i])
+		}
+	}
+
+	// Most scopes have nothing to stop, so don't create a deadline unless needed
+	if len(stoppable) == 0 {
+		return nil
+	}
+
+	// Every instance shares the one deadline, as with the kernel's Stop phase
+	ctx, cancel := context.WithTimeout(context.Background(), s.kernel.shutdownTimeout())
+	defer cancel()
+
+	var errs []error
+	for _, instance := range stoppable {
+		if err := stopService(ctx, instance); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lookupService returns a service already deployed in the kernel without deploying it.
+// If optional and the service has not been deployed then this returns nil.
+func (k *Kernel) lookupService(t reflect.Type, opts injectOptions, errorf func(string, ...interface{}) error) (Service, error) {
+	// Lazy injection can deploy services once running
+	k.indexMutex.RLock()
+	defer k.indexMutex.RUnlock()
+
+	n := getQualifiedServiceName(t, opts.name)
+	if resolved, exists := k.index[n]; exists {
+		return resolved, nil
+	}
+
+	if opts.optional {
+		return nil, nil
+	}
+	if opts.name != "" {
+		return nil, errorf("no %s registered with name %q", t, opts.name)
+	}
+	return nil, errorf("%s has not been deployed", t)
+}
@@ -0,0 +1,262 @@
+package kernel
+
+import (
+	"context"
+	"errors"
+	"github.com/peter-mount/go-kernel/v2/util/task"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scopeDB is a singleton service used by scoped instances
+type scopeDB struct{}
+
+// scopeTx is created once per scope
+type scopeTx struct {
+	db      *scopeDB `kernel:"inject"`
+	inited  bool
+	stopped *[]string
+	id      int
+}
+
+var scopeTxCount int
+
+func (tx *scopeTx) Init(_ *Kernel) error {
+	scopeTxCount++
+	tx.id = scopeTxCount
+	tx.inited = true
+	return nil
+}
+
+func (tx *scopeTx) Stop() {
+	if tx.stopped != nil {
+		*tx.stopped = append(*tx.stopped, "tx")
+	}
+}
+
+// scopeRepo is a scoped instance which depends on another
+type scopeRepo struct {
+	tx *scopeTx `kernel:"inject,scope=request"`
+}
+
+type scopeUser struct {
+	name string
+}
+
+type scopeHandler struct {
+	db   *scopeDB   `kernel:"inject"`
+	tx   *scopeTx   `kernel:"inject,scope=request"`
+	repo *scopeRepo `kernel:"inject,scope=request"`
+	user *scopeUser `kernel:"inject,scope=request,optional"`
+}
+
+func TestScope_Inject(t *testing.T) {
+	db := &scopeDB{}
+	k := NewKernel()
+	if err := k.DependsOn(db); err != nil {
+		t.Fatal(err)
+	}
+
+	scope := k.NewScope(ScopeRequest)
+	h := &scopeHandler{}
+	if err := scope.Inject(h); err != nil {
+		t.Fatal(err)
+	}
+
+	if h.db != db || h.tx.db != db {
+		t.Error("singleton not injected")
+	}
+	if !h.tx.inited {
+		t.Error("scoped instance not initialised")
+	}
+	if h.repo.tx != h.tx {
+		t.Error("scoped instance not shared within scope")
+	}
+	if h.user != nil {
+		t.Error("optional scoped instance created")
+	}
+
+	// Another scope gets its own instances
+	other := k.NewScope(ScopeRequest)
+	h2 := &scopeHandler{}
+	if err := other.Inject(h2); err != nil {
+		t.Fatal(err)
+	}
+	if h2.tx == h.tx || h2.tx.id == h.tx.id {
+		t.Error("scoped instance shared between scopes")
+	}
+
+	var stopped []string
+	h.tx.stopped = &stopped
+	if err := scope.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(stopped) != 1 {
+		t.Errorf("expected tx to be stopped once, got %v", stopped)
+	}
+
+	if err := scope.Inject(&scopeHandler{}); err == nil {
+		t.Error("expected error injecting from closed scope")
+	}
+}
+
+func TestScope_Add(t *testing.T) {
+	k := NewKernel()
+	if err := k.DependsOn(&scopeDB{}); err != nil {
+		t.Fatal(err)
+	}
+
+	scope := k.NewScope(ScopeRequest)
+	user := &scopeUser{name: "test"}
+	if err := scope.Add(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := scope.Add(&scopeUser{}); err == nil {
+		t.Error("expected error adding the same type twice")
+	}
+
+	h := &scopeHandler{}
+	if err := scope.Inject(h); err != nil {
+		t.Fatal(err)
+	}
+	if h.user != user {
+		t.Error("added instance not injected")
+	}
+
+	ctx := scope.Context(context.Background())
+	if GetScope(ctx) != scope {
+		t.Error("scope not in context")
+	}
+	if GetScope(context.Background()) != nil {
+		t.Error("expected no scope")
+	}
+}
+
+func TestScope_Errors(t *testing.T) {
+	// A singleton cannot have scoped fields
+	k := NewKernel()
+	if err := k.DependsOn(&scopeHandler{}); err == nil || !strings.Contains(err.Error(), "Scope.Inject") {
+		t.Errorf("expected scope error, got %v", err)
+	}
+
+	// Singletons are not deployed from within a scope
+	k = NewKernel()
+	if err := k.NewScope(ScopeRequest).Inject(&scopeHandler{}); err == nil || !strings.Contains(err.Error(), "not been deployed") {
+		t.Errorf("expected not deployed error, got %v", err)
+	}
+
+	// The scope must match
+	k = NewKernel()
+	if err := k.DependsOn(&scopeDB{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.NewScope(ScopeTask).Inject(&scopeHandler{}); err == nil || !strings.Contains(err.Error(), "scope request required") {
+		t.Errorf("expected scope mismatch error, got %v", err)
+	}
+}
+
+// TestScope_Worker ensures each task runs in its own scope
+func TestScope_Worker(t *testing.T) {
+	k := NewKernel()
+	if err := k.DependsOn(&scopeDB{}); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := k.AddService(&Worker{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := ws.(*Worker)
+
+	var txs []*scopeTx
+	inject := func(ctx context.Context) error {
+		scope := GetScope(ctx)
+		if scope == nil || scope.Name() != ScopeTask {
+			return errors.New("task not in scope")
+		}
+		h := &struct {
+			tx *scopeTx `kernel:"inject,scope=task"`
+		}{}
+		if err := scope.Inject(h); err != nil {
+			return err
+		}
+		txs = append(txs, h.tx)
+		return nil
+	}
+	w.AddTask(task.Of(inject, inject))
+	w.AddTask(inject)
+
+	if err := w.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(txs) != 3 || txs[0] != txs[1] || txs[1] == txs[2] {
+		t.Errorf("expected tasks to have their own scope")
+	}
+}
+
+// scopeSlow blocks in Init until scopeSlowRelease is closed
+type scopeSlow struct{}
+
+var scopeSlowStarting, scopeSlowRelease chan struct{}
+
+func (s *scopeSlow) Init(_ *Kernel) error {
+	close(scopeSlowStarting)
+	<-scopeSlowRelease
+	return nil
+}
+
+type scopeLazy struct {
+	slow func() (*scopeSlow, error) `kernel:"inject,lazy"`
+}
+
+// TestScope_InjectWhilstDeployingLazily ensures injecting from a scope does not wait for a service being deployed lazily
+func TestScope_InjectWhilstDeployingLazily(t *testing.T) {
+	scopeSlowStarting, scopeSlowRelease = make(chan struct{}), make(chan struct{})
+
+	db := &scopeDB{}
+	lazy := &scopeLazy{}
+	k := NewKernel()
+	if err := k.DependsOn(db, lazy); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.PostInit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := make(chan error, 1)
+	go func() {
+		_, err := lazy.slow()
+		resolved <- err
+	}()
+	<-scopeSlowStarting
+
+	injected := make(chan error, 1)
+	go func() {
+		scope := k.NewScope(ScopeRequest)
+		defer scope.Close()
+		injected <- scope.Inject(&struct {
+			db *scopeDB `kernel:"inject"`
+		}{})
+	}()
+
+	select {
+	case err := <-injected:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("scope blocked by lazy deployment")
+	}
+
+	close(scopeSlowRelease)
+	if err := <-resolved; err != nil {
+		t.Error(err)
+	}
+	if err := k.Shutdown(); err != nil {
+		t.Error(err)
+	}
+}
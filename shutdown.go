@@ -0,0 +1,101 @@
+package kernel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// shutdownTimeoutFlag is the flag used to set the deadline the services have to stop
+	shutdownTimeoutFlag = "shutdown-timeout"
+	// defaultShutdownTimeout is the stop deadline if the flag is not set
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+// shutdownTimeout returns the time the services have to stop
+func (k *Kernel) shutdownTimeout() time.Duration {
+	if d, ok := k.flagValue(shutdownTimeoutFlag).(time.Duration); ok {
+		return d
+	}
+	return defaultShutdownTimeout
+}
+
+func isStoppable(s Service) bool {
+	switch s.(type) {
+	case GracefulStoppableService, StoppableService:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop stops each service in the stopList in reverse order, removing them from the list
+// so that they cannot be stopped twice.
+func (k *Kernel) stop() error {
+	// Wait for any lazy deployment to finish, after which no more can happen.
+	// Anything it deployed which has yet to start is stopped by startService
+	k.lazyMutex.Lock()
+	k.mutex.Lock()
+	it := k.stopList.ReverseIterator()
+	k.stopList.Clear()
+	first := !k.stopping
+	k.stopping = true
+	k.mutex.Unlock()
+	k.lazyMutex.Unlock()
+
+	if first {
+		k.phaseChanged(PhaseStop)
+	}
+
+	// Every service shares the one deadline, so the time taken to stop is bounded however many there are
+	ctx, cancel := context.WithTimeout(context.Background(), k.shutdownTimeout())
+	defer cancel()
+
+	var errs []error
+	it.ForEach(func(s Service) {
+		err := k.observe(PhaseStop, s, func() error {
+			return stopService(ctx, s)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// stopService stops a single service, waiting until either it has stopped or ctx is done.
+// A service with a StopTimeout can shorten the deadline of ctx but not extend it.
+func stopService(ctx context.Context, s Service) error {
+	if st, ok := s.(StopTimeoutService); ok && st.StopTimeout() > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, st.StopTimeout())
+		defer cancel()
+	}
+
+	// Buffered so the goroutine can exit if we give up waiting for it
+	done := make(chan error, 1)
+	go func() {
+		switch ss := s.(type) {
+		case GracefulStoppableService:
+			done <- ss.Stop(ctx)
+		case StoppableService:
+			ss.Stop()
+			done <- nil
+		}
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("stop %s: %w", serviceName(s), err)
+		}
+		return nil
+
+	case <-ctx.Done():
+		log.Printf("Service %s did not stop within deadline, skipping", serviceName(s))
+		return fmt.Errorf("stop %s: %w", serviceName(s), ctx.Err())
+	}
+}
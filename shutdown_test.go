@@ -0,0 +1,137 @@
+package kernel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testGracefulService implements GracefulStoppableService
+type testGracefulService struct {
+	name    string
+	err     error
+	hang    bool
+	delay   time.Duration
+	timeout time.Duration
+	stopped bool
+}
+
+func (s *testGracefulService) Name() string {
+	return s.name
+}
+
+func (s *testGracefulService) Stop(ctx context.Context) error {
+	if s.hang {
+		<-ctx.Done()
+		// Simulate a service which ignores the deadline
+		time.Sleep(time.Second)
+	}
+	time.Sleep(s.delay)
+	s.stopped = true
+	return s.err
+}
+
+func (s *testGracefulService) StopTimeout() time.Duration {
+	return s.timeout
+}
+
+func TestKernel_GracefulStop(t *testing.T) {
+	stopErr := errors.New("stop failed")
+
+	clean := &testGracefulService{name: "clean", timeout: time.Second}
+	failing := &testGracefulService{name: "failing", timeout: time.Second, err: stopErr}
+	hanging := &testGracefulService{name: "hanging", timeout: 10 * time.Millisecond, hang: true}
+
+	k := NewKernel()
+	if err := k.DependsOn(clean, failing, hanging); err != nil {
+		t.Fatal(err)
+	}
+
+	err := k.Run()
+	if err == nil {
+		t.Fatal("expected stop errors")
+	}
+
+	if !errors.Is(err, stopErr) {
+		t.Errorf("stop error not reported: %v", err)
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("hanging service not reported: %v", err)
+	}
+
+	// The hanging service must not prevent the others from stopping
+	if !clean.stopped || !failing.stopped {
+		t.Errorf("services not stopped clean=%v failing=%v", clean.stopped, failing.stopped)
+	}
+}
+
+// TestKernel_GracefulStopDeadline ensures that every service shares the -shutdown-timeout deadline,
+// so the time taken to stop does not grow with the number of services which hang
+func TestKernel_GracefulStopDeadline(t *testing.T) {
+	k := NewKernel()
+	k.SetArgs("-shutdown-timeout", "100ms")
+	if err := k.DependsOn(
+		&testGracefulService{name: "first", hang: true},
+		&testGracefulService{name: "second", hang: true},
+		&testGracefulService{name: "third", hang: true},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err := k.Run()
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("hanging services not reported: %v", err)
+	}
+
+	// A deadline per service would take at least 300ms
+	if elapsed >= 250*time.Millisecond {
+		t.Errorf("shutdown took %v, expected about 100ms", elapsed)
+	}
+}
+
+func TestKernel_ShutdownTimeoutFlag(t *testing.T) {
+	k := NewKernel()
+	k.SetArgs("-shutdown-timeout", "5s")
+	if err := k.DependsOn(&testService{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := k.shutdownTimeout(); d != 5*time.Second {
+		t.Errorf("expected 5s got %v", d)
+	}
+}
+
+// testStartingService blocks in StartContext until the root context is cancelled
+type testStartingService struct{}
+
+func (s *testStartingService) StartContext(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// TestKernel_ShutdownDuringStart ensures Shutdown can be called from another goroutine at any time, e.g. on a signal,
+// and that the services starting are cancelled
+func TestKernel_ShutdownDuringStart(t *testing.T) {
+	k := NewKernel()
+	if err := k.DependsOn(&testStartingService{}); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := k.Shutdown(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := k.Run(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected start to be cancelled, got %v", err)
+	}
+}
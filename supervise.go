@@ -0,0 +1,141 @@
+package kernel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// maxCrashes is the number of entries kept in the crash log
+	maxCrashes = 100
+)
+
+// RestartPolicy defines how a supervised service is restarted when it fails
+type RestartPolicy struct {
+	// MaxRestarts is the number of times it will be restarted before the failure is escalated, -1 for unlimited
+	MaxRestarts int
+	// Backoff is the delay before the first restart, doubling after each one. Defaults to 100ms
+	Backoff time.Duration
+	// MaxBackoff is the maximum delay between restarts. Defaults to 30s
+	MaxBackoff time.Duration
+	// ResetAfter resets the restart count and backoff if it ran for at least this long before failing.
+	// 0 to never reset
+	ResetAfter time.Duration
+}
+
+// SupervisedService is an optional interface a RunnableService or ContextRunnableService can implement
+// so that it's restarted if it fails in the Run phase.
+//
+// Only once its RestartPolicy has been exhausted will the failure stop the kernel.
+// A panic is treated as a failure.
+type SupervisedService interface {
+	RestartPolicy() RestartPolicy
+}
+
+// Crash is an entry in the crash log of supervised services
+type Crash struct {
+	Service string    `json:"service"` // Name of the service
+	Time    time.Time `json:"time"`    // When it failed
+	Restart int       `json:"restart"` // Number of restarts before this failure
+	Error   string    `json:"error"`   // The error returned
+}
+
+// CrashLog returns the most recent failures of supervised services
+func (k *Kernel) CrashLog() []Crash {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return append([]Crash(nil), k.crashes...)
+}
+
+func (k *Kernel) logCrash(c Crash) {
+	log.Printf("Service %s failed after %d restarts: %s", c.Service, c.Restart, c.Error)
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.crashes = append(k.crashes, c)
+	if len(k.crashes) > maxCrashes {
+		k.crashes = k.crashes[len(k.crashes)-maxCrashes:]
+	}
+}
+
+// Supervise calls f, restarting it according to policy until it returns nil or ctx is cancelled.
+//
+// Every failure is recorded in the crash log. If the policy is exhausted then the last error is returned.
+// This can also be used by services to supervise their own background goroutines, with Fail() used
+// to escalate the returned error to the kernel.
+func (k *Kernel) Supervise(ctx context.Context, name string, policy RestartPolicy, f func(context.Context) error) error {
+	if policy.Backoff <= 0 {
+		policy.Backoff = 100 * time.Millisecond
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 30 * time.Second
+	}
+
+	backoff := policy.Backoff
+	restarts := 0
+	for {
+		started := time.Now()
+		err := callSafely(ctx, f)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		// Reset if it was stable for long enough
+		if policy.ResetAfter > 0 && time.Since(started) >= policy.ResetAfter {
+			restarts = 0
+			backoff = policy.Backoff
+		}
+
+		k.logCrash(Crash{Service: name, Time: time.Now(), Restart: restarts, Error: err.Error()})
+
+		if policy.MaxRestarts >= 0 && restarts >= policy.MaxRestarts {
+			return fmt.Errorf("%s failed after %d restarts: %w", name, restarts, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		restarts++
+		backoff = min(backoff*2, policy.MaxBackoff)
+	}
+}
+
+// callSafely calls f converting any panic into an error
+func callSafely(ctx context.Context, f func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return f(ctx)
+}
+
+// Fail stops the kernel with an error, e.g. from a background goroutine started by a service.
+// The root context is cancelled and the error is returned by Run() once the services have stopped.
+// Only the first error is kept. This does nothing if the kernel is not running.
+func (k *Kernel) Fail(err error) {
+	if err == nil {
+		err = errors.New("kernel failed")
+	}
+	if _, cancel := k.rootContext(); cancel != nil {
+		cancel(err)
+	}
+}
+
+// failure returns the error passed to Fail(), nil if none
+func (k *Kernel) failure() error {
+	ctx, _ := k.rootContext()
+	if ctx == nil {
+		return nil
+	}
+	if cause := context.Cause(ctx); cause != nil && !errors.Is(cause, context.Canceled) {
+		return cause
+	}
+	return nil
+}
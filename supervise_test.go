@@ -0,0 +1,97 @@
+package kernel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testSupervisedService fails a number of times before succeeding
+type testSupervisedService struct {
+	failures int
+	runs     int
+	policy   RestartPolicy
+}
+
+func (s *testSupervisedService) RestartPolicy() RestartPolicy {
+	return s.policy
+}
+
+func (s *testSupervisedService) Run() error {
+	s.runs++
+	if s.runs <= s.failures {
+		if s.runs == 1 {
+			panic("first run")
+		}
+		return errors.New("run failed")
+	}
+	return nil
+}
+
+func TestKernel_SupervisedRestart(t *testing.T) {
+	s := &testSupervisedService{failures: 2, policy: RestartPolicy{MaxRestarts: 3, Backoff: time.Millisecond}}
+	k := NewKernel()
+	if err := k.DependsOn(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.runs != 3 {
+		t.Errorf("expected 3 runs got %d", s.runs)
+	}
+
+	crashes := k.CrashLog()
+	if len(crashes) != 2 || crashes[0].Error != "panic: first run" || crashes[1].Restart != 1 {
+		t.Errorf("unexpected crash log %+v", crashes)
+	}
+}
+
+func TestKernel_SupervisedExhausted(t *testing.T) {
+	s := &testSupervisedService{failures: 10, policy: RestartPolicy{MaxRestarts: 2, Backoff: time.Millisecond}}
+	k := NewKernel()
+	if err := k.DependsOn(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Run(); err == nil {
+		t.Fatal("expected failure once restarts exhausted")
+	}
+
+	if s.runs != 3 {
+		t.Errorf("expected 3 runs got %d", s.runs)
+	}
+}
+
+// testFailService fails the kernel from a background goroutine
+type testFailService struct {
+	k   *Kernel
+	err error
+}
+
+func (s *testFailService) Init(k *Kernel) error {
+	s.k = k
+	return nil
+}
+
+func (s *testFailService) StartContext(_ context.Context) error {
+	go s.k.Fail(s.err)
+	return nil
+}
+
+func (s *testFailService) RunContext(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestKernel_Fail(t *testing.T) {
+	s := &testFailService{err: errors.New("background failure")}
+	k := NewKernel()
+	if err := k.DependsOn(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Run(); !errors.Is(err, s.err) {
+		t.Errorf("expected %v got %v", s.err, err)
+	}
+}
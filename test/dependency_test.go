@@ -1,6 +1,7 @@
 package test
 
 import (
+	"errors"
 	"github.com/peter-mount/go-kernel/v2"
 	"testing"
 )
@@ -41,3 +42,53 @@ func TestDependency_Existing(t *testing.T) {
 		t.Errorf("not same instance, %d!=%d expected %d", s2.s1.Id, s3.s1.Id, val)
 	}
 }
+
+// testCycleA, testCycleB & testCycleC form the cycle A -> B -> C -> A
+type testCycleA struct {
+	b *testCycleB `kernel:"inject"`
+}
+
+type testCycleB struct {
+	c *testCycleC `kernel:"inject"`
+}
+
+type testCycleC struct {
+	a *testCycleA `kernel:"inject"`
+}
+
+// TestDependency_Cycle ensures a circular dependency returns the full path of the cycle
+func TestDependency_Cycle(t *testing.T) {
+	err := kernel.Launch(&testCycleA{})
+	if err == nil {
+		t.Fatal("No error returned")
+	}
+
+	var cycle *kernel.CycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("expected CycleError got %v", err)
+	}
+
+	expected := []string{"b", "c", "a"}
+	if len(cycle.Path) != len(expected) {
+		t.Fatalf("expected %d hops got %v", len(expected), cycle.Path)
+	}
+	for i, f := range expected {
+		if cycle.Path[i].Field != f || cycle.Path[i].Tag != "inject" {
+			t.Errorf("hop %d expected field %q got %v", i, f, cycle.Path[i])
+		}
+	}
+
+	if first, last := cycle.Path[0].From, cycle.Path[len(cycle.Path)-1].To; first != last {
+		t.Errorf("cycle does not close, %q != %q", first, last)
+	}
+
+	prefix := "github.com/peter-mount/go-kernel/v2/test|"
+	msg := "Circular dependency " +
+		prefix + "testCycleA.b -> " +
+		prefix + "testCycleB.c -> " +
+		prefix + "testCycleC.a -> " +
+		prefix + "testCycleA"
+	if err.Error() != msg {
+		t.Errorf("unexpected error %q", err.Error())
+	}
+}
@@ -2,6 +2,7 @@ package test
 
 import (
 	"github.com/peter-mount/go-kernel/v2"
+	"strings"
 	"testing"
 )
 
@@ -126,3 +127,47 @@ func TestService_InjectNonPointer(t *testing.T) {
 		t.Fatal("Unexpected error returned: " + err.Error())
 	}
 }
+
+type testConfigItem struct {
+	Name string `yaml:"name"`
+}
+
+// TestService_InjectUnsupportedKind ensures fields only supported by inject are rejected by the other tags
+func TestService_InjectUnsupportedKind(t *testing.T) {
+	tests := []struct {
+		service  kernel.Service
+		expected string
+	}{
+		{
+			service: &struct {
+				items []testConfigItem `kernel:"config,items"`
+			}{},
+			expected: `kernel:"config" does not support a slice`,
+		},
+		{
+			service: &struct {
+				items map[string]testConfigItem `kernel:"config,items"`
+			}{},
+			expected: `kernel:"config" does not support a map`,
+		},
+		{
+			service: &struct {
+				worker func() *kernel.Worker `kernel:"worker"`
+			}{},
+			expected: `kernel:"worker" does not support a func`,
+		},
+		{
+			service: &struct {
+				port int `kernel:"config,port"`
+			}{},
+			expected: "must be a pointer",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := kernel.NewKernel().AddService(test.service)
+		if err == nil || !strings.HasSuffix(err.Error(), test.expected) {
+			t.Errorf("%T: expected %q got %v", test.service, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package interfaces
+
+import (
+	"github.com/peter-mount/go-kernel/v2"
+	"testing"
+)
+
+// Store is implemented by multiple services registered with RegisterNamedAPI
+type Store interface {
+	Id() string
+}
+
+// store implements Store returning its id
+type store struct {
+	id string
+}
+
+func (s *store) Id() string { return s.id }
+
+// StoreConsumer injects the Store implementations in each of the supported ways
+type StoreConsumer struct {
+	primary   Store            `kernel:"inject,name=primary"`
+	secondary Store            `kernel:"inject,name=secondary"`
+	all       []Store          `kernel:"inject,all"`
+	byName    map[string]Store `kernel:"inject,all"`
+}
+
+func TestNamedAPI(t *testing.T) {
+	kernel.RegisterNamedAPI((*Store)(nil), "primary", &store{id: "p"})
+	kernel.RegisterNamedAPI((*Store)(nil), "secondary", &store{id: "s"})
+	kernel.RegisterAPI((*Store)(nil), &store{id: "default"})
+
+	c := &StoreConsumer{}
+	if err := kernel.Launch(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.primary == nil || c.primary.Id() != "p" {
+		t.Errorf("primary not injected, got %v", c.primary)
+	}
+
+	if c.secondary == nil || c.secondary.Id() != "s" {
+		t.Errorf("secondary not injected, got %v", c.secondary)
+	}
+
+	if len(c.all) != 3 || c.all[0].Id() != "p" || c.all[1].Id() != "s" || c.all[2].Id() != "default" {
+		t.Errorf("expected all 3 in registration order, got %v", c.all)
+	}
+
+	if len(c.byName) != 3 || c.byName["primary"].Id() != "p" || c.byName[""].Id() != "default" {
+		t.Errorf("expected map of 3 by name, got %v", c.byName)
+	}
+}
+
+// AllConsumer only injects every Store implementation
+type AllConsumer struct {
+	all    []Store          `kernel:"inject,all"`
+	byName map[string]Store `kernel:"inject,all"`
+}
+
+// TestNamedAPI_RegisteredLater ensures implementations registered after the consumer has been deployed,
+// e.g. by a plugin, are still injected
+func TestNamedAPI_RegisteredLater(t *testing.T) {
+	c := &AllConsumer{}
+	kernel.Register(c)
+
+	kernel.RegisterNamedAPI((*Store)(nil), "primary", &store{id: "p"})
+	kernel.RegisterNamedAPI((*Store)(nil), "secondary", &store{id: "s"})
+
+	if err := kernel.Launch(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.all) != 2 || c.all[0].Id() != "p" || c.all[1].Id() != "s" {
+		t.Errorf("expected both implementations, got %v", c.all)
+	}
+
+	if len(c.byName) != 2 || c.byName["secondary"].Id() != "s" {
+		t.Errorf("expected map of both by name, got %v", c.byName)
+	}
+}
+
+// MissingConsumer injects a name that has not been registered
+type MissingConsumer struct {
+	missing Store `kernel:"inject,name=missing"`
+}
+
+func TestNamedAPI_Missing(t *testing.T) {
+	err := kernel.Launch(&MissingConsumer{})
+	if err == nil {
+		t.Fatal("No error returned")
+	}
+}
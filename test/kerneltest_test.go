@@ -0,0 +1,131 @@
+package test
+
+import (
+	"errors"
+	"github.com/peter-mount/go-kernel/v2"
+	"github.com/peter-mount/go-kernel/v2/kerneltest"
+	"testing"
+)
+
+// harnessStore is an API with a real implementation and a mock
+type harnessStore interface {
+	Get() string
+}
+
+// harnessDB is a service which is overridden by the test, so Init must not be called
+type harnessDB struct {
+	url string
+}
+
+func (d *harnessDB) Init(_ *kernel.Kernel) error {
+	return errors.New("harnessDB should not be initialised")
+}
+
+func (d *harnessDB) Stop() {}
+
+type harnessMock struct {
+	value   string
+	stopped bool
+}
+
+func (m *harnessMock) Get() string {
+	return m.value
+}
+
+func (m *harnessMock) Stop() {
+	m.stopped = true
+}
+
+type harnessSettings struct {
+	Greeting string `yaml:"greeting"`
+}
+
+type harnessServer struct {
+	db       *harnessDB       `kernel:"inject"`
+	store    harnessStore     `kernel:"inject"`
+	name     *string          `kernel:"flag,name,Name,world"`
+	settings *harnessSettings `kernel:"config,harness"`
+	started  bool
+}
+
+func (s *harnessServer) Start() error {
+	s.started = true
+	return nil
+}
+
+func (s *harnessServer) Stop() {}
+
+func (s *harnessServer) Greet() string {
+	return s.settings.Greeting + " " + *s.name + " from " + s.store.Get()
+}
+
+// TestHarness ensures mocks, flags and config are used and the lifecycle can be run one phase at a time
+func TestHarness(t *testing.T) {
+	db := &harnessDB{url: "mock"}
+	store := &harnessMock{value: "mock store"}
+	server := &harnessServer{}
+
+	h := kerneltest.New(t).
+		Override(db).
+		OverrideAPI((*harnessStore)(nil), store).
+		Args("-name", "test").
+		Config("harness:\n  greeting: hello\n").
+		Init(server)
+
+	if server.db != db {
+		t.Fatal("override not injected")
+	}
+
+	h.PostInit()
+	if server.started {
+		t.Fatal("server started during PostInit")
+	}
+
+	h.Start()
+	if !server.started {
+		t.Fatal("server not started")
+	}
+
+	if got, want := server.Greet(), "hello test from mock store"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	h.Stop().AssertStopOrder(server, store, db)
+	if !store.stopped {
+		t.Error("mock not stopped")
+	}
+}
+
+// harnessInjectedMock is a mock with its own dependencies, which must not be injected when overridden
+type harnessInjectedMock struct {
+	db *harnessDB `kernel:"inject"`
+}
+
+func (m *harnessInjectedMock) Init(_ *kernel.Kernel) error {
+	return errors.New("harnessInjectedMock should not be initialised")
+}
+
+func (m *harnessInjectedMock) Get() string {
+	return "injected mock"
+}
+
+// TestHarness_OverrideAPI ensures a mock registered against an API is neither injected nor initialised
+func TestHarness_OverrideAPI(t *testing.T) {
+	mock := &harnessInjectedMock{}
+	named := &harnessInjectedMock{}
+	server := &harnessServer{}
+
+	kerneltest.New(t).
+		Override(&harnessDB{}).
+		OverrideAPI((*harnessStore)(nil), mock).
+		OverrideNamedAPI((*harnessStore)(nil), "named", named).
+		Init(server)
+
+	if server.store != mock {
+		t.Error("mock not injected")
+	}
+
+	if mock.db != nil || named.db != nil {
+		t.Error("mock was injected")
+	}
+}
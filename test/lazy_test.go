@@ -0,0 +1,322 @@
+package test
+
+import (
+	"github.com/peter-mount/go-kernel/v2"
+	"testing"
+	"time"
+)
+
+// optionalAPI is never registered
+type optionalAPI interface {
+	Get() int
+}
+
+type optionalDep struct{}
+
+type optionalService struct {
+	api      optionalAPI      `kernel:"inject,optional"`
+	missing  *optionalDep     `kernel:"inject,optional"`
+	existing *testDepService1 `kernel:"inject,optional"`
+}
+
+// TestInject_Optional ensures optional injection points are left nil if not available
+func TestInject_Optional(t *testing.T) {
+	s1 := &testDepService1{}
+	s := &optionalService{}
+
+	err := kernel.Launch(s1, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.api != nil {
+		t.Errorf("expected nil api")
+	}
+
+	if s.missing != nil {
+		t.Errorf("expected nil service")
+	}
+
+	if s.existing != s1 {
+		t.Errorf("expected deployed service to be injected")
+	}
+}
+
+// lazyDep is deployed only when the lazy func is called
+type lazyDep struct {
+	postInit bool
+	start    bool
+	stop     bool
+}
+
+func (s *lazyDep) PostInit() error {
+	s.postInit = true
+	return nil
+}
+
+func (s *lazyDep) Start() error {
+	s.start = true
+	return nil
+}
+
+func (s *lazyDep) Stop() {
+	s.stop = true
+}
+
+type lazyService struct {
+	dep      func() *lazyDep             `kernel:"inject,lazy"`
+	optional func() (optionalAPI, error) `kernel:"inject,lazy,optional"`
+	resolved *lazyDep
+}
+
+func (s *lazyService) Run() error {
+	s.resolved = s.dep()
+	if s.resolved != s.dep() {
+		panic("lazy func returned a different instance")
+	}
+
+	if api, err := s.optional(); api != nil || err != nil {
+		panic("expected nil optional api")
+	}
+	return nil
+}
+
+// TestInject_Lazy ensures a lazy dependency is not deployed until it's needed
+func TestInject_Lazy(t *testing.T) {
+	s := &lazyService{}
+
+	err := kernel.Launch(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := s.resolved
+	if d == nil {
+		t.Fatal("lazy dependency not resolved")
+	}
+
+	if !d.postInit || !d.start {
+		t.Errorf("lazy dependency not initialised postInit=%v start=%v", d.postInit, d.start)
+	}
+
+	if !d.stop {
+		t.Errorf("lazy dependency not stopped")
+	}
+}
+
+// lazyStopService only resolves its lazy dependency once the kernel is stopping
+type lazyStopService struct {
+	dep      func() (*lazyDep, error) `kernel:"inject,lazy"`
+	resolved *lazyDep
+	err      error
+}
+
+func (s *lazyStopService) Stop() {
+	s.resolved, s.err = s.dep()
+}
+
+// TestInject_LazyStopping ensures a lazy dependency is not deployed once stopping, as it would never be stopped
+func TestInject_LazyStopping(t *testing.T) {
+	s := &lazyStopService{}
+
+	err := kernel.Launch(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.err == nil || s.resolved != nil {
+		t.Errorf("expected lazy dependency to fail once stopping, got %v", s.err)
+	}
+}
+
+// lazyLeaf is the last of a chain of lazy dependencies
+type lazyLeaf struct {
+	started bool
+}
+
+func (s *lazyLeaf) Start() error {
+	s.started = true
+	return nil
+}
+
+// lazyStartLeaf is only deployed from the Start of lazyNested
+type lazyStartLeaf struct {
+	lazyLeaf
+}
+
+// lazyNested resolves its own lazy dependencies from each of its lifecycle phases
+type lazyNested struct {
+	init     func() (*lazyLeaf, error)      `kernel:"inject,lazy"`
+	postInit func() (*lazyLeaf, error)      `kernel:"inject,lazy"`
+	start    func() (*lazyStartLeaf, error) `kernel:"inject,lazy"`
+	leaf     *lazyLeaf
+	started  *lazyStartLeaf
+}
+
+func (s *lazyNested) Init(_ *kernel.Kernel) error {
+	_, err := s.init()
+	return err
+}
+
+func (s *lazyNested) PostInit() error {
+	var err error
+	s.leaf, err = s.postInit()
+	return err
+}
+
+func (s *lazyNested) Start() error {
+	var err error
+	s.started, err = s.start()
+	return err
+}
+
+type lazyRoot struct {
+	nested   func() (*lazyNested, error) `kernel:"inject,lazy"`
+	resolved *lazyNested
+}
+
+func (s *lazyRoot) Run() error {
+	var err error
+	s.resolved, err = s.nested()
+	return err
+}
+
+// TestInject_LazyNested ensures a service resolved lazily can resolve its own lazy dependencies whilst it's being
+// deployed and started
+func TestInject_LazyNested(t *testing.T) {
+	s := &lazyRoot{}
+
+	k := kernel.NewKernel()
+	if err := k.DependsOn(s); err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- k.Run()
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock resolving nested lazy dependencies")
+	}
+
+	if s.resolved == nil || s.resolved.leaf == nil || !s.resolved.leaf.started {
+		t.Error("nested lazy dependency not started")
+	}
+
+	if s.resolved == nil || s.resolved.started == nil || !s.resolved.started.started {
+		t.Error("lazy dependency resolved from Start not started")
+	}
+}
+
+// lazyCountedDep counts how many times it has been started and stopped
+type lazyCountedDep struct {
+	starts int
+	stops  int
+}
+
+func (s *lazyCountedDep) Start() error {
+	s.starts++
+	return nil
+}
+
+func (s *lazyCountedDep) Stop() {
+	s.stops++
+}
+
+// lazyPostInitService resolves its lazy dependency in PostInit, before the Start phase
+type lazyPostInitService struct {
+	dep      func() *lazyCountedDep `kernel:"inject,lazy"`
+	resolved *lazyCountedDep
+}
+
+func (s *lazyPostInitService) PostInit() error {
+	s.resolved = s.dep()
+	return nil
+}
+
+// TestInject_LazyPostInit ensures a lazy dependency resolved before the Start phase is started only once
+func TestInject_LazyPostInit(t *testing.T) {
+	s := &lazyPostInitService{}
+
+	k := kernel.NewKernel()
+	if err := k.DependsOn(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := s.resolved; d == nil || d.starts != 1 || d.stops != 1 {
+		t.Errorf("expected lazy dependency started & stopped once, got %+v", d)
+	}
+}
+
+// lazyReentrantLeaf is resolved lazily by lazyReentrantZ
+type lazyReentrantLeaf struct {
+	lazyLeaf
+}
+
+// lazyReentrantZ is deployed normally, but only resolves its lazy dependency when lazyReentrantY is deployed
+type lazyReentrantZ struct {
+	leaf func() (*lazyReentrantLeaf, error) `kernel:"inject,lazy"`
+}
+
+// lazyReentrantY calls the lazy func of the already deployed lazyReentrantZ from its Init
+type lazyReentrantY struct {
+	z    *lazyReentrantZ `kernel:"inject"`
+	leaf *lazyReentrantLeaf
+}
+
+func (s *lazyReentrantY) Init(_ *kernel.Kernel) error {
+	var err error
+	s.leaf, err = s.z.leaf()
+	return err
+}
+
+// lazyReentrantX resolves lazyReentrantY lazily once running
+type lazyReentrantX struct {
+	y        func() (*lazyReentrantY, error) `kernel:"inject,lazy"`
+	z        *lazyReentrantZ                 `kernel:"inject"`
+	resolved *lazyReentrantY
+}
+
+func (s *lazyReentrantX) Run() error {
+	var err error
+	s.resolved, err = s.y()
+	return err
+}
+
+// TestInject_LazyReentrant ensures a service deployed lazily can call the lazy func of one already deployed
+// from its Init without deadlocking
+func TestInject_LazyReentrant(t *testing.T) {
+	s := &lazyReentrantX{}
+
+	k := kernel.NewKernel()
+	if err := k.DependsOn(s); err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- k.Run()
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock resolving a lazy dependency from Init")
+	}
+
+	if s.resolved == nil || s.resolved.leaf == nil || !s.resolved.leaf.started {
+		t.Error("lazy dependency resolved from Init not started")
+	}
+}
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"github.com/peter-mount/go-kernel/v2"
+	"github.com/peter-mount/go-kernel/v2/plugins"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+// TestKernel_Plugin builds a plugin then ensures its services are deployed and its flags parsed
+func TestKernel_Plugin(t *testing.T) {
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not available")
+	}
+
+	// The plugin must be built with the same settings as the test
+	settings := make(map[string]string)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			settings[s.Key] = s.Value
+		}
+	}
+
+	if settings["CGO_ENABLED"] != "1" {
+		t.Skip("plugins require cgo")
+	}
+
+	if testing.CoverMode() != "" {
+		t.Skip("plugins cannot be loaded when built with -cover")
+	}
+
+	dir := t.TempDir()
+	args := []string{"build", "-buildmode=plugin", "-o", filepath.Join(dir, "test.so")}
+	if settings["-race"] == "true" {
+		args = append(args, "-race")
+	}
+
+	build := exec.Command(goCmd, append(args, "./testdata/plugin")...)
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build plugin: %v\n%s", err, out)
+	}
+
+	out := filepath.Join(t.TempDir(), "started")
+
+	k := kernel.NewKernel()
+	if err := k.DependsOn(&plugins.Loader{}); err != nil {
+		t.Fatal(err)
+	}
+	k.SetArgs("-plugins", dir, "-plugin-out", out)
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := os.ReadFile(out); err != nil || string(b) != "started" {
+		t.Errorf("plugin service not started: %q %v", b, err)
+	}
+}
+
+// TestKernel_LoadPlugins ensures only files ending in .so are loaded, and that an invalid plugin fails the kernel
+func TestKernel_LoadPlugins(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	k := kernel.NewKernel()
+	if err := k.DependsOn(&plugins.Loader{}); err != nil {
+		t.Fatal(err)
+	}
+	k.SetArgs("-plugins", dir)
+	if err := k.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.so"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	k = kernel.NewKernel()
+	if err := k.DependsOn(&plugins.Loader{}); err != nil {
+		t.Fatal(err)
+	}
+	k.SetArgs("-plugins", dir)
+	if err := k.Run(); err == nil || !strings.Contains(err.Error(), "bad.so") {
+		t.Errorf("expected plugin error, got %v", err)
+	}
+
+	if err := plugins.Load(kernel.NewKernel(), filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
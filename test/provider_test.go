@@ -0,0 +1,65 @@
+package test
+
+import (
+	"errors"
+	"github.com/peter-mount/go-kernel/v2"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// providerConfig is a normal service used as a dependency of the provider
+type providerConfig struct {
+	timeout time.Duration
+}
+
+func (c *providerConfig) PostInit() error {
+	c.timeout = time.Second
+	return nil
+}
+
+type providerService struct {
+	client *http.Client `kernel:"inject"`
+	other  *http.Client `kernel:"inject"`
+}
+
+// TestProvide ensures a provider is used to create a third party type
+func TestProvide(t *testing.T) {
+	calls := 0
+	var conf *providerConfig
+	kernel.Provide(func(c *providerConfig) *http.Client {
+		calls++
+		conf = c
+		return &http.Client{}
+	})
+
+	s := &providerService{}
+	if err := kernel.Launch(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.client == nil {
+		t.Fatal("client not injected")
+	}
+
+	if s.client != s.other || calls != 1 {
+		t.Errorf("provider called %d times, expected a single instance", calls)
+	}
+
+	if conf == nil || conf.timeout != time.Second {
+		t.Errorf("provider parameter not resolved from the kernel")
+	}
+}
+
+// TestProvide_Error ensures an error from a provider fails the kernel
+func TestProvide_Error(t *testing.T) {
+	providerErr := errors.New("no client")
+	kernel.Provide(func() (*http.Client, error) {
+		return nil, providerErr
+	})
+
+	err := kernel.Launch(&providerService{})
+	if !errors.Is(err, providerErr) {
+		t.Fatalf("expected %v got %v", providerErr, err)
+	}
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"fmt"
+	"github.com/peter-mount/go-kernel/v2"
+	"github.com/peter-mount/go-kernel/v2/rest"
+	"strings"
+	"testing"
+)
+
+// TestRestServer_Isolated ensures the rest server's flags belong to the kernel it's deployed in
+func TestRestServer_Isolated(t *testing.T) {
+	for _, port := range []int{8081, 8082} {
+		server := &rest.Server{}
+		k := kernel.NewKernel()
+		if err := k.DependsOn(server); err != nil {
+			t.Fatal(err)
+		}
+
+		k.SetArgs("-rest-port", fmt.Sprint(port))
+		if err := k.PostInit(); err != nil {
+			t.Fatal(err)
+		}
+
+		if server.Port != port {
+			t.Errorf("expected port %d, got %d", port, server.Port)
+		}
+	}
+}
+
+// TestRestServer_Env ensures the RESTPORT environment variable is used when -rest-port is not set
+func TestRestServer_Env(t *testing.T) {
+	t.Setenv("RESTPORT", "8083")
+
+	server := &rest.Server{}
+	k := kernel.NewKernel()
+	if err := k.DependsOn(server); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := k.PostInit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Port != 8083 {
+		t.Errorf("expected port 8083, got %d", server.Port)
+	}
+}
+
+// TestRestServer_NoFlags ensures the rest server's flags are not declared when NoFlags is set
+func TestRestServer_NoFlags(t *testing.T) {
+	server := &rest.Server{NoFlags: true, Port: 8083}
+	k := kernel.NewKernel()
+	if err := k.DependsOn(server); err != nil {
+		t.Fatal(err)
+	}
+
+	if f := k.FlagSet().Lookup("rest-port"); f != nil {
+		t.Errorf("rest-port declared with NoFlags")
+	}
+
+	if err := k.PostInit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Port != 8083 {
+		t.Errorf("expected port 8083, got %d", server.Port)
+	}
+}
+
+// TestRestServer_Help ensures the rest server's flags are listed under the server in the help
+func TestRestServer_Help(t *testing.T) {
+	k := kernel.NewKernel()
+	if err := k.DependsOn(&rest.Server{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var help strings.Builder
+	k.WriteHelp(&help)
+
+	if !strings.Contains(help.String(), "\nrest.Server\n  -rest-cert") {
+		t.Errorf("rest flags not listed under rest.Server:\n%s", help.String())
+	}
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"github.com/peter-mount/go-kernel/v2"
+	"os"
+	"testing"
+	"time"
+)
+
+// signalService blocks in Run until Stop is called, like a server without context support
+type signalService struct {
+	running chan struct{}
+	stop    chan struct{}
+}
+
+func (s *signalService) Run() error {
+	close(s.running)
+	<-s.stop
+	return nil
+}
+
+func (s *signalService) Stop() {
+	close(s.stop)
+}
+
+// TestLaunch_Signal ensures services are stopped as soon as a signal is received,
+// not once the shutdown deadline has passed
+func TestLaunch_Signal(t *testing.T) {
+	s := &signalService{running: make(chan struct{}), stop: make(chan struct{})}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- kernel.Launch(s)
+	}()
+
+	<-s.running
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skip("signals not supported:", err)
+	}
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("expected clean exit got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("service not stopped on signal")
+	}
+}
@@ -0,0 +1,20 @@
+// Package main is a plugin used by TestKernel_Plugin
+package main
+
+import (
+	"github.com/peter-mount/go-kernel/v2"
+	"os"
+)
+
+type pluginService struct {
+	out *string `kernel:"flag,plugin-out,File to write to once started"`
+}
+
+func (s *pluginService) Start() error {
+	return os.WriteFile(*s.out, []byte("started"), 0644)
+}
+
+// Services returns the services deployed by the plugin
+func Services() []kernel.Service {
+	return []kernel.Service{&pluginService{}}
+}
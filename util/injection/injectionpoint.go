@@ -2,18 +2,20 @@ package injection
 
 import (
 	"fmt"
-	"log"
 	"reflect"
 	"unsafe"
 )
 
 type Point struct {
-	f  int
-	sf reflect.StructField
-	tv reflect.Value
-	t  reflect.Type
+	f     int
+	sf    reflect.StructField
+	tv    reflect.Value
+	t     reflect.Type
+	value bool
 }
 
+// Type returns the type being injected. For a pointer this is the type pointed to,
+// for a slice or map it's the element type and for a func it's the type it returns.
 func (ip *Point) Type() reflect.Type {
 	return ip.t
 }
@@ -22,6 +24,16 @@ func (ip *Point) StructField() reflect.StructField {
 	return ip.sf
 }
 
+// IsValue returns true if the field holds a value, e.g. a struct, rather than a pointer, interface, slice, map or func
+func (ip *Point) IsValue() bool {
+	return ip.value
+}
+
+// Owner returns the instance containing the field being injected
+func (ip *Point) Owner() interface{} {
+	return ip.tv.Interface()
+}
+
 func Of(f int, sf reflect.StructField, tv reflect.Value) (*Point, error) {
 	ip := &Point{
 		f:  f,
@@ -36,9 +48,24 @@ func Of(f int, sf reflect.StructField, tv reflect.Value) (*Point, error) {
 	case reflect.Ptr:
 		ip.t = ip.sf.Type.Elem()
 
+	case reflect.Slice, reflect.Map:
+		// The element type, e.g. when injecting multiple services
+		ip.t = ip.sf.Type.Elem()
+
+	case reflect.Func:
+		// A provider function, the type is the one it returns
+		if ip.sf.Type.NumOut() == 0 {
+			return nil, ip.Errorf("func must return a value")
+		}
+		ip.t = ip.sf.Type.Out(0)
+		if ip.t.Kind() == reflect.Ptr {
+			ip.t = ip.t.Elem()
+		}
+
 	default:
-		log.Println(ip.sf.Type, ip.sf.Type.Kind())
-		return nil, ip.Errorf("must be a pointer")
+		// A value, only supported by some tags
+		ip.t = ip.sf.Type
+		ip.value = true
 	}
 
 	return ip, nil
@@ -67,10 +94,14 @@ func (ip *Point) Get() reflect.Value {
 	return reflect.NewAt(tf.Type(), unsafe.Pointer(tf.UnsafeAddr())).Elem()
 }
 
-// Set sets a field in a value with a specific instance of an interface
+// Set sets a field in a value with a specific instance of an interface.
+// If the field holds a value then val can be a pointer to that value.
 func (ip *Point) Set(val interface{}) {
 	// Convert our resolved service into a Value then convert to the field's type
 	vv := reflect.ValueOf(val)
+	if ip.value && vv.Kind() == reflect.Ptr {
+		vv = vv.Elem()
+	}
 	ip.Get().Set(vv.Convert(ip.sf.Type))
 }
 
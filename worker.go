@@ -2,6 +2,7 @@ package kernel
 
 import (
 	"context"
+	"errors"
 	"github.com/peter-mount/go-kernel/v2/util"
 	"github.com/peter-mount/go-kernel/v2/util/task"
 	"time"
@@ -9,9 +10,24 @@ import (
 
 type Worker struct {
 	daemon *Daemon `kernel:"inject"`
+	kernel *Kernel
 	tasks  util.PriorityQueue[task.Task]
 }
 
+// workerRestartPolicy is used when running tasks in the background.
+// A failing task should not stop the webserver so this restarts indefinitely.
+var workerRestartPolicy = RestartPolicy{
+	MaxRestarts: -1,
+	Backoff:     10 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+	ResetAfter:  time.Minute,
+}
+
+func (w *Worker) Init(k *Kernel) error {
+	w.kernel = k
+	return nil
+}
+
 // AddTask adds a task with priority 0
 func (w *Worker) AddTask(task task.Task) task.Queue {
 	w.tasks.Add(task)
@@ -25,34 +41,52 @@ func (w *Worker) AddPriorityTask(priority int, task task.Task) task.Queue {
 	return w
 }
 
+// Start is the same as StartContext(context.Background())
 func (w *Worker) Start() error {
+	return w.StartContext(context.Background())
+}
+
+// StartContext kernel stage. If in webserver mode then tasks are run in the background
+// until ctx is cancelled. Any task which fails is logged and the worker restarted.
+func (w *Worker) StartContext(ctx context.Context) error {
 	// If in webserver mode then run tasks in the background
 	if w.daemon.IsWebserver() {
 		go func() {
-			for {
-				_ = w.runDaemon()
+			if err := w.kernel.Supervise(ctx, "worker", workerRestartPolicy, w.runDaemon); err != nil {
+				w.kernel.Fail(err)
 			}
 		}()
 	}
 	return nil
 }
 
-// Run kernel stage. This just calls RunTasks()
+// Run is the same as RunContext(context.Background())
 func (w *Worker) Run() error {
+	return w.RunContext(context.Background())
+}
+
+// RunContext kernel stage. This runs the queued tasks until the queue is empty,
+// or if in daemon mode until ctx is cancelled.
+func (w *Worker) RunContext(ctx context.Context) error {
 	if !w.daemon.IsWebserver() {
-		return w.runDaemon()
+		return w.runDaemon(ctx)
 	}
 	return nil
 }
 
-func (w *Worker) runDaemon() error {
+func (w *Worker) runDaemon(ctx context.Context) error {
 	run := true
 	for run {
-		if err := w.run(context.Background()); err != nil {
+		if err := w.run(ctx); err != nil {
 			return err
 		}
 		run = w.daemon.IsDaemon()
-		time.Sleep(time.Millisecond * 10)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond * 10):
+		}
 	}
 	return nil
 }
@@ -61,9 +95,12 @@ func (w *Worker) run(ctx context.Context) error {
 	// Ensure we have a reference to the Queue in the context
 	ctx = context.WithValue(ctx, ctxKey, w)
 
-	// Run each task in sequence until either an error or the queue is empty
+	// Run each task in sequence until either an error or the queue is empty.
+	// Each task runs within its own ScopeTask Scope.
 	return w.tasks.Drain(func(t task.Task) error {
-		return t.Do(ctx)
+		scope := w.kernel.NewScope(ScopeTask)
+		err := t.Do(scope.Context(ctx))
+		return errors.Join(err, scope.Close())
 	})
 }
 